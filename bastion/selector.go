@@ -0,0 +1,269 @@
+// Package bastion selects the bastion host to jump through, based on the
+// results of health probes.
+package bastion
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultProbeTimeout is the default time to wait for a bastion host to
+	// accept the connection.
+	DefaultProbeTimeout = 2 * time.Second
+	// DefaultCooldown is the default time a failed bastion host is skipped for.
+	DefaultCooldown = 5 * time.Minute
+
+	defaultPort = "22"
+)
+
+// Status stores the result of a single bastion host probe.
+type Status struct {
+	Host    string
+	Healthy bool
+	Latency time.Duration
+	Err     error
+	// CooldownUntil stores the time until which the host is skipped, it's
+	// zero if the host is healthy.
+	CooldownUntil time.Time
+}
+
+// state stores the contents of the state file.
+type state struct {
+	// Failures stores the time of the last failed probe of each host.
+	Failures map[string]time.Time `json:"failures"`
+	// Refreshes stores the time the bastion hosts of each region were last
+	// refreshed.
+	Refreshes map[string]time.Time `json:"refreshes"`
+}
+
+// Selector probes the bastion hosts and selects the healthy one with the
+// lowest latency. Failed hosts are remembered in the state file and skipped
+// until the cooldown period passes.
+type Selector struct {
+	stateFile string
+	timeout   time.Duration
+	cooldown  time.Duration
+
+	mu        sync.Mutex
+	failures  map[string]time.Time
+	refreshes map[string]time.Time
+}
+
+// NewSelector creates a new Selector. If stateFile is empty, the failed hosts
+// are not remembered between the Selector instances.
+func NewSelector(stateFile string, timeout, cooldown time.Duration) *Selector {
+	return &Selector{
+		stateFile: stateFile,
+		timeout:   timeout,
+		cooldown:  cooldown,
+	}
+}
+
+// DefaultStateFile returns the default state file location,
+// $XDG_STATE_HOME/fst/bastions.state, or ~/.local/state/fst/bastions.state if
+// XDG_STATE_HOME is not set.
+func DefaultStateFile() (string, error) {
+	stateHome := os.Getenv("XDG_STATE_HOME")
+	if stateHome == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		stateHome = filepath.Join(home, ".local", "state")
+	}
+	return filepath.Join(stateHome, "fst", "bastions.state"), nil
+}
+
+// Select returns the healthy host with the lowest latency. The hosts in
+// cooldown are probed only if none of the other ones is healthy.
+func (s *Selector) Select(hosts []string) (string, error) {
+	if len(hosts) == 0 {
+		return "", fmt.Errorf("no bastion hosts to select from")
+	}
+
+	s.mu.Lock()
+	s.loadState()
+	s.mu.Unlock()
+
+	candidates, cooling := []string{}, []string{}
+	for _, host := range hosts {
+		if s.coolingDown(host) {
+			cooling = append(cooling, host)
+		} else {
+			candidates = append(candidates, host)
+		}
+	}
+
+	statuses := []Status{}
+	for _, group := range [][]string{candidates, cooling} {
+		if len(group) == 0 {
+			continue
+		}
+
+		results := s.probe(group)
+		if results[0].Healthy {
+			return results[0].Host, nil
+		}
+		statuses = append(statuses, results...)
+	}
+
+	errs := make([]string, len(statuses))
+	for i, status := range statuses {
+		errs[i] = fmt.Sprintf("%s: %v", status.Host, status.Err)
+	}
+	return "", fmt.Errorf("no reachable bastion host: %s", strings.Join(errs, ", "))
+}
+
+// Probe probes all the hosts, regardless of the cooldown. The statuses of
+// healthy hosts come first, sorted by latency.
+func (s *Selector) Probe(hosts []string) []Status {
+	s.mu.Lock()
+	s.loadState()
+	s.mu.Unlock()
+
+	return s.probe(hosts)
+}
+
+// RefreshedAt returns the time the bastion hosts of the region were last
+// refreshed, see SetRefreshed. It's zero if they never were.
+func (s *Selector) RefreshedAt(region string) time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.loadState()
+	return s.refreshes[region]
+}
+
+// SetRefreshed records the current time as the time the bastion hosts of the
+// region were refreshed, so the refreshes can be rate limited.
+func (s *Selector) SetRefreshed(region string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.loadState()
+	s.refreshes[region] = time.Now()
+	s.saveState()
+}
+
+// probe checks concurrently if the hosts accept connections on the ssh port
+// and saves the failures in the state file.
+func (s *Selector) probe(hosts []string) []Status {
+	statuses := make([]Status, len(hosts))
+	wg := sync.WaitGroup{}
+	for i, host := range hosts {
+		wg.Add(1)
+		go func(i int, host string) {
+			defer wg.Done()
+			statuses[i] = s.probeHost(host)
+		}(i, host)
+	}
+	wg.Wait()
+
+	s.mu.Lock()
+	for i, status := range statuses {
+		if status.Healthy {
+			delete(s.failures, status.Host)
+			continue
+		}
+		s.failures[status.Host] = time.Now()
+		statuses[i].CooldownUntil = s.failures[status.Host].Add(s.cooldown)
+	}
+	s.saveState()
+	s.mu.Unlock()
+
+	sort.SliceStable(statuses, func(i, j int) bool {
+		if statuses[i].Healthy != statuses[j].Healthy {
+			return statuses[i].Healthy
+		}
+		return statuses[i].Latency < statuses[j].Latency
+	})
+	return statuses
+}
+
+// probeHost measures the time it takes the host to accept the connection.
+func (s *Selector) probeHost(host string) Status {
+	start := time.Now()
+	conn, err := net.DialTimeout("tcp", address(host), s.timeout)
+	if err != nil {
+		return Status{Host: host, Err: err}
+	}
+	conn.Close()
+
+	return Status{Host: host, Healthy: true, Latency: time.Since(start)}
+}
+
+// coolingDown reports whether the host failed within the cooldown period.
+func (s *Selector) coolingDown(host string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	failedAt, ok := s.failures[host]
+	return ok && time.Since(failedAt) < s.cooldown
+}
+
+// loadState reads the failed hosts and the refresh times from the state file.
+// A missing or invalid state file is treated as empty.
+func (s *Selector) loadState() {
+	s.failures = map[string]time.Time{}
+	s.refreshes = map[string]time.Time{}
+	if s.stateFile == "" {
+		return
+	}
+
+	data, err := ioutil.ReadFile(s.stateFile)
+	if err != nil {
+		return
+	}
+
+	st := state{}
+	if err = json.Unmarshal(data, &st); err != nil {
+		return
+	}
+	if st.Failures != nil {
+		s.failures = st.Failures
+	}
+	if st.Refreshes != nil {
+		s.refreshes = st.Refreshes
+	}
+}
+
+// saveState writes the failed hosts and the refresh times to the state file.
+// The state is only a hint, so the errors are ignored.
+func (s *Selector) saveState() {
+	if s.stateFile == "" {
+		return
+	}
+
+	data, err := json.Marshal(state{
+		Failures:  s.failures,
+		Refreshes: s.refreshes,
+	})
+	if err != nil {
+		return
+	}
+	if err = os.MkdirAll(filepath.Dir(s.stateFile), 0700); err != nil {
+		return
+	}
+	ioutil.WriteFile(s.stateFile, data, 0600)
+}
+
+// address returns the host address with the user removed and the default ssh
+// port added if it's not set.
+func address(host string) string {
+	if i := strings.LastIndex(host, "@"); i >= 0 {
+		host = host[i+1:]
+	}
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+	return net.JoinHostPort(strings.Trim(host, "[]"), defaultPort)
+}
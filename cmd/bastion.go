@@ -0,0 +1,230 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/gr00by87/fst/bastion"
+	"github.com/gr00by87/fst/config"
+	"github.com/gr00by87/fst/core"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// bastionCmd represents the bastion command.
+	bastionCmd = &cobra.Command{
+		Use:   "bastion",
+		Short: "Manage bastion hosts",
+		Long:  "This subcommand manages the bastion hosts used by ssh, scp and exec subcommands.",
+	}
+
+	// bastionStatusCmd represents the bastion status command.
+	bastionStatusCmd = &cobra.Command{
+		Use:   "status",
+		Args:  cobra.NoArgs,
+		Short: "Show bastion hosts health",
+		Long:  "This subcommand probes the ssh port of all the configured bastion hosts and shows their health and latency. Failed bastion hosts are skipped by ssh, scp and exec subcommands until the cooldown period passes.",
+		Run:   runBastionStatus,
+	}
+)
+
+// init initializes the cobra command and flags.
+func init() {
+	rootCmd.AddCommand(bastionCmd)
+	bastionCmd.AddCommand(bastionStatusCmd)
+}
+
+// runBastionStatus executes the bastion status command.
+func runBastionStatus(_ *cobra.Command, _ []string) {
+	cfg := checkBastionHosts()
+	selector := newBastionSelector(cfg)
+
+	regions := []string{}
+	for region := range cfg.BastionHosts {
+		regions = append(regions, region)
+	}
+	sort.Strings(regions)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "\tREGION\tVPC\tHOST\tLATENCY\tCOOLDOWN UNTIL\tERROR")
+	for _, region := range regions {
+		vpcs := map[string][]string{}
+		for _, host := range cfg.BastionHosts[region] {
+			if host.VPCID != "" {
+				vpcs[host.IP] = append(vpcs[host.IP], host.VPCID)
+			}
+		}
+
+		for _, status := range selector.Probe(cfg.BastionAddresses(region, "")) {
+			vpc := strings.Join(vpcs[status.Host], ",")
+			if status.Healthy {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t\t\n", success, region, vpc, status.Host, status.Latency.Round(time.Millisecond))
+				continue
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t\t%s\t%v\n", failure, region, vpc, status.Host, status.CooldownUntil.Format(time.RFC3339), status.Err)
+		}
+	}
+	w.Flush()
+}
+
+// discoverBastionHosts finds the bastion hosts of the regions. Bastion hosts
+// of the regions with static ones configured are not discovered. The servers
+// mapped to VPCs are added to the servers with the discovery tag.
+func discoverBastionHosts(ctx context.Context, cfg *config.Config, provider core.Provider, regions []string) (map[string][]config.BastionHost, error) {
+	bastionHosts := map[string][]config.BastionHost{}
+	discoverRegions := []string{}
+	for _, region := range regions {
+		addresses := cfg.Bastion.Static[region]
+		if len(addresses) == 0 {
+			discoverRegions = append(discoverRegions, region)
+			continue
+		}
+
+		for _, address := range addresses {
+			bastionHosts[region] = append(bastionHosts[region], config.BastionHost{IP: address})
+		}
+	}
+
+	if len(discoverRegions) == 0 {
+		return bastionHosts, nil
+	}
+
+	key, value := cfg.Bastion.GetTag()
+	servers, err := provider.ListServers(ctx, discoverRegions, core.NewFilter(key, []string{value}, core.Equals, false))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, server := range servers {
+		addBastionHost(bastionHosts, server, server.VPCID)
+	}
+
+	privateNetworks, err := cfg.PrivateNetworks()
+	if err != nil {
+		return nil, err
+	}
+
+	vpcs := []string{}
+	for vpc := range cfg.Bastion.VPCs {
+		vpcs = append(vpcs, vpc)
+	}
+	sort.Strings(vpcs)
+
+	for _, vpc := range vpcs {
+		for _, id := range cfg.Bastion.VPCs[vpc] {
+			servers, err := provider.FindServers(ctx, discoverRegions, core.NewServerID(id, privateNetworks...))
+			if err != nil {
+				return nil, err
+			}
+
+			for _, server := range servers {
+				addBastionHost(bastionHosts, server, vpc)
+			}
+		}
+	}
+
+	return bastionHosts, nil
+}
+
+// addBastionHost adds the server to the region bastion hosts, if it's running
+// and has a public ip address.
+func addBastionHost(bastionHosts map[string][]config.BastionHost, server core.Server, vpc string) {
+	if server.State != core.StateRunning || server.PublicIP == "" {
+		return
+	}
+
+	bastionHosts[server.Region] = append(bastionHosts[server.Region], config.BastionHost{
+		Name:       server.Name,
+		InstanceID: server.InstanceID,
+		IP:         server.PublicIP,
+		VPCID:      vpc,
+	})
+}
+
+// refreshBastionHosts refreshes the stored region bastion hosts. If they're
+// unreachable, they're discovered again right away. Otherwise, they're checked
+// against the server inventory first and discovered again only if any of them
+// is no longer a running instance with the same ip address. Missing instance
+// ids of bastion hosts stored by older versions are filled in. Static bastion
+// hosts are never refreshed. Reports whether the bastion hosts were
+// discovered again.
+func refreshBastionHosts(ctx context.Context, cfg *config.Config, provider core.Provider, selector *bastion.Selector, region string, unreachable bool) bool {
+	if len(cfg.BastionHosts[region]) == 0 || len(cfg.Bastion.Static[region]) > 0 {
+		return false
+	}
+	selector.SetRefreshed(region)
+
+	if !unreachable {
+		stale, updated := checkBastionInstances(ctx, provider, region, cfg.BastionHosts[region])
+		if !stale {
+			if updated {
+				if err := config.SaveToFile(cfg); err != nil {
+					fmt.Fprintln(os.Stderr, warning, "Error saving bastion hosts:", err)
+				}
+			}
+			return false
+		}
+	}
+
+	bastionHosts, err := discoverBastionHosts(ctx, cfg, newProvider(cfg, true), []string{region})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, warning, "Error refreshing bastion hosts:", err)
+		return false
+	}
+
+	if len(bastionHosts[region]) == 0 {
+		fmt.Fprintln(os.Stderr, warning, "No running bastion hosts found in region", region)
+		return false
+	}
+
+	cfg.BastionHosts[region] = bastionHosts[region]
+	if err = config.SaveToFile(cfg); err != nil {
+		fmt.Fprintln(os.Stderr, warning, "Error saving bastion hosts:", err)
+		return false
+	}
+
+	fmt.Fprintln(os.Stderr, info, "Bastion hosts list updated for region", region)
+	return true
+}
+
+// checkBastionInstances reports whether any of the bastion hosts is not a
+// running instance with the stored ip address. Bastion hosts stored without
+// instance ids, by older versions, are looked up by the ip address and their
+// instance ids are filled in, in which case updated is true.
+func checkBastionInstances(ctx context.Context, provider core.Provider, region string, bastionHosts []config.BastionHost) (stale, updated bool) {
+	servers, err := provider.ListServers(ctx, []string{region})
+	if err != nil {
+		return false, false
+	}
+
+	byID, byIP := map[string]core.Server{}, map[string]core.Server{}
+	for _, server := range servers {
+		if server.State != core.StateRunning {
+			continue
+		}
+		byID[server.InstanceID] = server
+		byIP[server.PublicIP] = server
+	}
+
+	for i, host := range bastionHosts {
+		if host.InstanceID == "" {
+			server, ok := byIP[host.IP]
+			if !ok || server.InstanceID == "" {
+				return true, updated
+			}
+			bastionHosts[i].InstanceID = server.InstanceID
+			updated = true
+			continue
+		}
+
+		if server, ok := byID[host.InstanceID]; !ok || server.PublicIP != host.IP {
+			return true, updated
+		}
+	}
+	return false, updated
+}
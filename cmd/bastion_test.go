@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/gr00by87/fst/config"
+	"github.com/gr00by87/fst/core"
+)
+
+func TestCheckBastionInstances(t *testing.T) {
+	provider := &fakeProvider{
+		servers: []core.Server{
+			{Name: "bastion-1", Region: "us-east-1", InstanceID: "i-01234567", PublicIP: "1.1.1.1", State: core.StateRunning},
+			{Name: "bastion-2", Region: "us-east-1", InstanceID: "i-89abcdef", PublicIP: "2.2.2.2", State: core.StateRunning},
+			{Name: "bastion-3", Region: "us-east-1", InstanceID: "i-00000000", PublicIP: "3.3.3.3", State: "stopped"},
+		},
+	}
+
+	tests := []struct {
+		name        string
+		hosts       []config.BastionHost
+		wantStale   bool
+		wantUpdated bool
+		wantIDs     []string
+	}{
+		{
+			name:    "running instances",
+			hosts:   []config.BastionHost{{InstanceID: "i-01234567", IP: "1.1.1.1"}, {InstanceID: "i-89abcdef", IP: "2.2.2.2"}},
+			wantIDs: []string{"i-01234567", "i-89abcdef"},
+		},
+		{
+			name:        "missing instance ids filled in",
+			hosts:       []config.BastionHost{{IP: "1.1.1.1"}, {InstanceID: "i-89abcdef", IP: "2.2.2.2"}},
+			wantUpdated: true,
+			wantIDs:     []string{"i-01234567", "i-89abcdef"},
+		},
+		{
+			name:      "unknown ip address without instance id",
+			hosts:     []config.BastionHost{{IP: "4.4.4.4"}},
+			wantStale: true,
+			wantIDs:   []string{""},
+		},
+		{
+			name:      "changed ip address",
+			hosts:     []config.BastionHost{{InstanceID: "i-01234567", IP: "4.4.4.4"}},
+			wantStale: true,
+			wantIDs:   []string{"i-01234567"},
+		},
+		{
+			name:      "stopped instance",
+			hosts:     []config.BastionHost{{InstanceID: "i-00000000", IP: "3.3.3.3"}},
+			wantStale: true,
+			wantIDs:   []string{"i-00000000"},
+		},
+		{
+			name:      "terminated instance",
+			hosts:     []config.BastionHost{{InstanceID: "i-11111111", IP: "1.1.1.1"}},
+			wantStale: true,
+			wantIDs:   []string{"i-11111111"},
+		},
+	}
+
+	for _, tt := range tests {
+		stale, updated := checkBastionInstances(context.Background(), provider, "us-east-1", tt.hosts)
+		if stale != tt.wantStale || updated != tt.wantUpdated {
+			t.Errorf("%s: checkBastionInstances() = %t, %t, want %t, %t", tt.name, stale, updated, tt.wantStale, tt.wantUpdated)
+		}
+
+		ids := []string{}
+		for _, host := range tt.hosts {
+			ids = append(ids, host.InstanceID)
+		}
+		if !reflect.DeepEqual(ids, tt.wantIDs) {
+			t.Errorf("%s: instance ids = %v, want %v", tt.name, ids, tt.wantIDs)
+		}
+	}
+}
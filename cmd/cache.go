@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/gr00by87/fst/config"
+	"github.com/gr00by87/fst/core"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// cacheCmd represents the cache command.
+	cacheCmd = &cobra.Command{
+		Use:   "cache",
+		Short: "Manage server inventory cache",
+		Long:  "This subcommand manages the local server inventory cache used by ls, ssh and scp subcommands.",
+	}
+
+	// cacheClearCmd represents the cache clear command.
+	cacheClearCmd = &cobra.Command{
+		Use:   "clear",
+		Args:  cobra.NoArgs,
+		Short: "Remove all cached servers",
+		Long:  "This subcommand removes all the cached servers, they will be retrieved from AWS on next use.",
+		Run:   runCacheClear,
+	}
+
+	// cacheStatusCmd represents the cache status command.
+	cacheStatusCmd = &cobra.Command{
+		Use:   "status",
+		Args:  cobra.NoArgs,
+		Short: "Show cache status",
+		Long:  "This subcommand lists the cached regions with their last update time and number of servers.",
+		Run:   runCacheStatus,
+	}
+)
+
+// init initializes the cobra command and flags.
+func init() {
+	rootCmd.AddCommand(cacheCmd)
+	cacheCmd.AddCommand(cacheClearCmd)
+	cacheCmd.AddCommand(cacheStatusCmd)
+}
+
+// runCacheClear executes the cache clear command.
+func runCacheClear(_ *cobra.Command, _ []string) {
+	cache := loadCache()
+	if err := cache.Clear(); err != nil {
+		exitWithError(fmt.Errorf("error clearing cache: %v", err))
+	}
+
+	fmt.Println(success, "Cache cleared successfully")
+}
+
+// runCacheStatus executes the cache status command.
+func runCacheStatus(_ *cobra.Command, _ []string) {
+	cache := loadCache()
+	statuses, err := cache.Status()
+	if err != nil {
+		exitWithError(fmt.Errorf("error reading cache: %v", err))
+	}
+
+	if len(statuses) == 0 {
+		fmt.Println(info, "Cache is empty")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "REGION\tSERVERS\tUPDATED\tSTATUS")
+	for _, status := range statuses {
+		state := "fresh"
+		if status.Expired {
+			state = "expired"
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", status.Region, status.Servers, status.UpdatedAt.Format(time.RFC3339), state)
+	}
+	w.Flush()
+}
+
+// loadCache loads the config file and creates the inventory cache.
+func loadCache() *core.CachedProvider {
+	cfg, err := config.LoadFromFile()
+	if err != nil {
+		cfg = &config.Config{}
+	}
+
+	cache, err := newCache(cfg, core.NewEC2Provider(cfg.AWSCredentials), false)
+	if err != nil {
+		exitWithError(err)
+	}
+	return cache
+}
@@ -1,24 +1,53 @@
 package cmd
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
+	"github.com/gr00by87/fst/bastion"
 	"github.com/gr00by87/fst/config"
+	"github.com/gr00by87/fst/core"
 	"github.com/logrusorgru/aurora"
 	surveyCore "gopkg.in/AlecAivazis/survey.v1/core"
 )
 
+const (
+	// discoveryTimeout is the overall timeout of a server discovery request.
+	discoveryTimeout = 30 * time.Second
+	// bastionCheckInterval is the time after which the stored bastion hosts
+	// are checked against the server inventory again.
+	bastionCheckInterval = time.Hour
+	// bastionRefreshInterval is the minimum time between the discoveries of
+	// unreachable bastion hosts.
+	bastionRefreshInterval = 5 * time.Minute
+)
+
 var (
 	// status symbols.
 	success = aurora.Green("✓")
 	failure = aurora.Red("✗")
 	info    = aurora.Cyan("ⓘ")
+	warning = aurora.Yellow("⚠")
+
+	// newProvider creates the server inventory provider used by the commands.
+	// It can be replaced to run the commands against a different inventory.
+	// If refresh is set, the inventory cache is bypassed.
+	newProvider = func(cfg *config.Config, refresh bool) core.Provider {
+		var provider core.Provider = core.NewEC2Provider(cfg.AWSCredentials)
+		if cfg.Cache.IsDisabled() {
+			return provider
+		}
 
-	disableBastionHostCheck = map[string]bool{
-		"us-east-1": true,
+		cache, err := newCache(cfg, provider, refresh)
+		if err != nil {
+			return provider
+		}
+		return cache
 	}
 )
 
@@ -42,8 +71,201 @@ func checkBastionHosts() *config.Config {
 	return cfg
 }
 
-// randomHost selects a random host from hosts slice.
-func randomHost(hosts []string) string {
-	rand.Seed(time.Now().Unix())
-	return hosts[rand.Intn(len(hosts))]
+// jumpHost selects the bastion host to jump through to reach the server.
+// Bastion hosts in the server VPC are preferred, see
+// config.Config.BastionAddresses. Returns an empty string if the server region
+// doesn't need a bastion host. The region bastion hosts are checked against
+// the server inventory once per bastionCheckInterval and discovered again if
+// none of them is reachable, at most once per bastionRefreshInterval.
+func jumpHost(ctx context.Context, cfg *config.Config, provider core.Provider, server core.Server) (string, error) {
+	selector := newBastionSelector(cfg)
+	if time.Since(selector.RefreshedAt(server.Region)) > bastionCheckInterval {
+		refreshBastionHosts(ctx, cfg, provider, selector, server.Region, false)
+	}
+
+	bastionHosts := cfg.BastionAddresses(server.Region, server.VPCID)
+	if len(bastionHosts) == 0 {
+		if cfg.GetRegion(server.Region).NoBastion {
+			return "", nil
+		}
+		if server.VPCID != "" {
+			return "", fmt.Errorf("bastion host not found for vpc: %s in region: %s", server.VPCID, server.Region)
+		}
+		return "", fmt.Errorf("bastion host not found for region: %s", server.Region)
+	}
+
+	host, err := selector.Select(bastionHosts)
+	if err == nil || time.Since(selector.RefreshedAt(server.Region)) < bastionRefreshInterval {
+		return host, err
+	}
+	if !refreshBastionHosts(ctx, cfg, provider, selector, server.Region, true) {
+		return "", err
+	}
+	return selector.Select(cfg.BastionAddresses(server.Region, server.VPCID))
+}
+
+// newBastionSelector creates the bastion host selector. Failed bastion hosts
+// are shared by all the contexts, as they're identified by the address. The
+// state file is kept outside the cache directory, so it can't clash with the
+// inventory cache of any context.
+func newBastionSelector(cfg *config.Config) *bastion.Selector {
+	stateFile, _ := bastion.DefaultStateFile()
+
+	timeout := bastion.DefaultProbeTimeout
+	if cfg.Bastion.ProbeTimeout > 0 {
+		timeout = time.Duration(cfg.Bastion.ProbeTimeout) * time.Millisecond
+	}
+
+	cooldown := bastion.DefaultCooldown
+	if cfg.Bastion.Cooldown > 0 {
+		cooldown = time.Duration(cfg.Bastion.Cooldown) * time.Second
+	}
+
+	return bastion.NewSelector(stateFile, timeout, cooldown)
+}
+
+// discoveryContext returns a context bounded by the discovery timeout.
+func discoveryContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), discoveryTimeout)
+}
+
+// checkDiscoveryError prints a warning to stderr for every region that failed
+// to respond. Exits with error if the discovery failed entirely.
+func checkDiscoveryError(err error) {
+	if err == nil {
+		return
+	}
+
+	partialErr, ok := err.(*core.PartialError)
+	if !ok {
+		exitWithError(err)
+	}
+
+	for _, regionErr := range partialErr.Errors {
+		fmt.Fprintln(os.Stderr, warning, "Skipping region", regionErr.Error())
+	}
+}
+
+// newCache creates the inventory cache wrapping the provider.
+func newCache(cfg *config.Config, provider core.Provider, refresh bool) (*core.CachedProvider, error) {
+	dir, err := core.DefaultCacheDir()
+	if err != nil {
+		return nil, err
+	}
+
+	// Each context has its own cache, as contexts use different accounts.
+	if cfg.Context != "" {
+		dir = filepath.Join(dir, cfg.Context)
+	}
+
+	ttl := core.DefaultCacheTTL
+	if cfg.Cache.TTL > 0 {
+		ttl = time.Duration(cfg.Cache.TTL) * time.Second
+	}
+
+	return core.NewCachedProvider(provider, dir, ttl, refresh), nil
+}
+
+// configuredRegions returns the regions the commands operate on. If region
+// auto-discovery is enabled, all the regions enabled in the account are
+// returned.
+func configuredRegions(ctx context.Context, cfg *config.Config, provider core.Provider) ([]string, error) {
+	if !cfg.GetAutoDiscoverRegions() {
+		return cfg.RegionNames(), nil
+	}
+
+	discoverer, ok := provider.(core.RegionDiscoverer)
+	if !ok {
+		return nil, errors.New("region discovery not supported by the server provider")
+	}
+
+	regions, err := discoverer.DiscoverRegions(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error discovering regions: %v", err)
+	}
+	return regions, nil
+}
+
+// checkRegions validates passed regions against the allowed ones. If `all` is
+// passed, it returns all the allowed regions. If no region is passed, it
+// returns the first allowed region. If any invalid region passed it returns an
+// error.
+func checkRegions(regions []string, allowedRegions []string) ([]string, error) {
+	if len(regions) == 0 {
+		if len(allowedRegions) == 0 {
+			return nil, errors.New("no regions configured")
+		}
+		return allowedRegions[:1], nil
+	}
+
+	if regions[0] == "all" {
+		return allowedRegions, nil
+	}
+
+	for _, region := range regions {
+		isValid := false
+		for _, allowedRegion := range allowedRegions {
+			if region == allowedRegion {
+				isValid = true
+				break
+			}
+		}
+
+		if !isValid {
+			return nil, fmt.Errorf("invalid region: %s", region)
+		}
+	}
+
+	return regions, nil
+}
+
+// parseMatchers parses the tag comparisons and the filter expression into
+// server matchers.
+func parseMatchers(tags []string, expr string, ignoreCase bool) ([]core.Matcher, error) {
+	exprs := append([]string{}, tags...)
+	if expr != "" {
+		exprs = append(exprs, expr)
+	}
+
+	matchers := []core.Matcher{}
+	for _, expr := range exprs {
+		matcher, err := core.ParseExpr(expr, ignoreCase)
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, matcher)
+	}
+	return matchers, nil
+}
+
+// execCommand replaces the current process with the ssh or scp command, or
+// prints it if printOnly is set.
+func execCommand(cmd []string, printOnly bool) {
+	if printOnly {
+		fmt.Println(shellQuote(cmd))
+		return
+	}
+
+	if err := execProcess(cmd); err != nil {
+		exitWithError(fmt.Errorf("error executing %s: %v", cmd[0], err))
+	}
+}
+
+// shellQuote joins the arguments into a command line that can be safely
+// evaluated by a POSIX shell.
+func shellQuote(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = arg
+		if arg == "" || strings.IndexFunc(arg, isShellSpecial) >= 0 {
+			quoted[i] = "'" + strings.Replace(arg, "'", `'\''`, -1) + "'"
+		}
+	}
+	return strings.Join(quoted, " ")
+}
+
+// isShellSpecial reports whether the rune has to be quoted in a shell
+// command line.
+func isShellSpecial(r rune) bool {
+	return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("@%+=:,./_-", r))
 }
@@ -3,8 +3,10 @@ package cmd
 import (
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"strconv"
+	"strings"
 	"text/tabwriter"
 
 	"github.com/gr00by87/fst/config"
@@ -16,8 +18,12 @@ import (
 )
 
 var (
+	configImportFile  *string
+	configShowSecrets *bool
+
 	awsCredentials *bool
 	bastionHosts   *bool
+	regionsConfig  *bool
 	vpnConfig      *bool
 	checkStatus    *bool
 
@@ -28,21 +34,73 @@ var (
 		Long:  "This subcommand displays prompts to setup a configuration file. If no flag is passed, the whole configuration is run.",
 		Run:   runConfig,
 	}
+
+	// configValidateCmd represents the config validate command.
+	configValidateCmd = &cobra.Command{
+		Use:   "validate [file]",
+		Args:  cobra.MaximumNArgs(1),
+		Short: "Validate configuration file",
+		Long:  "This subcommand checks the configuration file, or the passed one, and reports all the problems found. The file is not migrated nor changed.",
+		Run:   runConfigValidate,
+	}
+
+	// configGetCmd represents the config get command.
+	configGetCmd = &cobra.Command{
+		Use:   "get <key>",
+		Args:  cobra.ExactArgs(1),
+		Short: "Print configuration value",
+		Long:  "This subcommand prints the value of the configuration key, e.g. aws_credentials.source, of the current context. Values overridden by FST_* environment variables are printed as overridden.",
+		Run:   runConfigGet,
+	}
+
+	// configSetCmd represents the config set command.
+	configSetCmd = &cobra.Command{
+		Use:   "set <key> <value>",
+		Args:  cobra.ExactArgs(2),
+		Short: "Set configuration value",
+		Long:  "This subcommand sets the value of the configuration key, e.g. `fst config set aws_credentials.source profile`. Lists accept comma separated values, e.g. `fst config set bastion.static.us-west-2 10.0.0.1,10.0.0.2`, other complex values accept json. Setting a map entry to an empty value removes it.",
+		Run:   runConfigSet,
+	}
+
+	// configImportCmd represents the config import command.
+	configImportCmd = &cobra.Command{
+		Use:   "import",
+		Args:  cobra.NoArgs,
+		Short: "Import configuration",
+		Long:  "This subcommand replaces the configuration of the current context with the json file created by `fst config export`. Redacted secrets keep the current values.",
+		Run:   runConfigImport,
+	}
+
+	// configExportCmd represents the config export command.
+	configExportCmd = &cobra.Command{
+		Use:   "export",
+		Args:  cobra.NoArgs,
+		Short: "Export configuration",
+		Long:  "This subcommand prints the configuration of the current context as json, to be loaded with `fst config import`. The secrets are redacted unless --show-secrets flag is passed.",
+		Run:   runConfigExport,
+	}
 )
 
 // init initializes the cobra command and flags.
 func init() {
 	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configValidateCmd, configGetCmd, configSetCmd, configImportCmd, configExportCmd)
+	configSetCmd.Long += "\n\nKeys:\n  " + strings.Join(config.Keys(), "\n  ")
+	configImportFile = configImportCmd.Flags().StringP("file", "f", "", "configuration file location, - reads from stdin")
+	configImportCmd.MarkFlagRequired("file")
+	configShowSecrets = configExportCmd.Flags().Bool("show-secrets", false, "export the secrets in plain text")
 	awsCredentials = configCmd.Flags().BoolP("aws-credentials", "a", false, "displays prompts to setup aws credentials")
 	bastionHosts = configCmd.Flags().BoolP("bastion-hosts", "b", false, "updates bastion hosts list")
+	regionsConfig = configCmd.Flags().BoolP("regions", "R", false, "displays prompts to select regions")
 	vpnConfig = configCmd.Flags().BoolP("vpn-config", "v", false, "displays prompts to setup vpn (optional)")
 	checkStatus = configCmd.Flags().BoolP("check-status", "c", false, "checks configuration status")
+	configCmd.Flags().MarkDeprecated("check-status", "use `fst doctor` instead")
 }
 
 // runConfig executes the config command.
 func runConfig(_ *cobra.Command, _ []string) {
 	if *checkStatus {
-		checkConfigStatus()
+		runDoctor(nil, nil)
 		return
 	}
 
@@ -53,7 +111,7 @@ func runConfig(_ *cobra.Command, _ []string) {
 	)
 
 	// No switch passed, run the whole configuration.
-	if !*awsCredentials && !*vpnConfig && !*bastionHosts {
+	if !*awsCredentials && !*vpnConfig && !*bastionHosts && !*regionsConfig {
 		runAll = true
 	}
 
@@ -64,6 +122,19 @@ func runConfig(_ *cobra.Command, _ []string) {
 		fmt.Println(success, "AWS credentials updated successfully")
 	}
 
+	switch {
+	case runAll:
+		if !proceed("Do you want to change the regions configuration?") {
+			break
+		}
+		fallthrough
+	case *regionsConfig:
+		if err = saveConfig(cfg, getRegions); err != nil {
+			exitWithError(err)
+		}
+		fmt.Println(success, "Regions updated successfully")
+	}
+
 	if *bastionHosts || runAll {
 		if err = saveConfig(cfg, getBastionHosts); err != nil {
 			exitWithError(err)
@@ -85,15 +156,128 @@ func runConfig(_ *cobra.Command, _ []string) {
 	}
 }
 
+// runConfigValidate executes the config validate command.
+func runConfigValidate(_ *cobra.Command, args []string) {
+	path := ""
+	if len(args) > 0 {
+		path = args[0]
+	}
+
+	version, errs := config.ValidateFile(path)
+	if len(errs) > 0 {
+		for _, err := range errs {
+			fmt.Println(failure, err)
+		}
+		os.Exit(1)
+	}
+
+	if version < config.CurrentVersion {
+		fmt.Println(info, fmt.Sprintf("Configuration file version %d will be migrated to version %d on next use", version, config.CurrentVersion))
+	}
+	fmt.Println(success, "Configuration file is valid")
+}
+
+// runConfigGet executes the config get command.
+func runConfigGet(_ *cobra.Command, args []string) {
+	cfg, err := config.LoadFromFile()
+	if err != nil {
+		exitWithError(err)
+	}
+
+	value, err := cfg.Get(args[0])
+	if err != nil {
+		exitWithError(err)
+	}
+	fmt.Println(value)
+}
+
+// runConfigSet executes the config set command.
+func runConfigSet(_ *cobra.Command, args []string) {
+	key, value := args[0], args[1]
+	err := saveConfig(nil, func(cfg *config.Config) error {
+		if err := cfg.Set(key, value); err != nil {
+			return err
+		}
+
+		// Problems with other keys don't block fixing this one.
+		for _, err := range cfg.Validate() {
+			if strings.HasPrefix(err.Error(), key) {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		exitWithError(err)
+	}
+	fmt.Println(success, "Configuration value updated successfully")
+}
+
+// runConfigImport executes the config import command.
+func runConfigImport(_ *cobra.Command, _ []string) {
+	var (
+		data []byte
+		err  error
+	)
+	if *configImportFile == "-" {
+		data, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		data, err = ioutil.ReadFile(*configImportFile)
+	}
+	if err != nil {
+		exitWithError(err)
+	}
+
+	// The current config is optional, it only provides the redacted secrets.
+	current, err := config.LoadFromFile()
+	if err != nil && !config.IsNotExist(err) {
+		exitWithError(err)
+	}
+
+	cfg, err := config.Import(data, current)
+	if err != nil {
+		exitWithError(fmt.Errorf("error importing %s: %v", *configImportFile, err))
+	}
+
+	if errs := cfg.Validate(); len(errs) > 0 {
+		for _, err := range errs {
+			fmt.Println(failure, err)
+		}
+		os.Exit(1)
+	}
+
+	if err = config.SaveToFile(cfg); err != nil {
+		exitWithError(err)
+	}
+	fmt.Println(success, "Configuration imported successfully")
+}
+
+// runConfigExport executes the config export command.
+func runConfigExport(_ *cobra.Command, _ []string) {
+	cfg, err := config.LoadFromFile()
+	if err != nil {
+		exitWithError(err)
+	}
+
+	data, err := config.Export(cfg, *configShowSecrets)
+	if err != nil {
+		exitWithError(err)
+	}
+	os.Stdout.Write(data)
+}
+
 // saveConfig is a wrapper around configuration functions to save the changes
-// after each configuration step.
+// after each configuration step. A new configuration is started only if
+// there's none yet.
 func saveConfig(cfg *config.Config, cfgFunc func(*config.Config) error) error {
 	var err error
 
 	if cfg == nil {
 		cfg, err = config.LoadFromFile()
-		if err != nil {
+		if config.IsNotExist(err) {
 			cfg = &config.Config{}
+		} else if err != nil {
+			return err
 		}
 	}
 
@@ -106,25 +290,151 @@ func saveConfig(cfg *config.Config, cfgFunc func(*config.Config) error) error {
 
 // getAWSCredentials runs aws credentials configuration.
 func getAWSCredentials(cfg *config.Config) error {
+	// The replaced secret is removed from the secret store.
+	if err := cfg.ReadSecrets(); err != nil {
+		return err
+	}
+
 	surveyCore.QuestionIcon = "🔒"
-	prompts := []*survey.Question{
-		{
-			Name:     "ID",
-			Prompt:   &survey.Input{Message: "Enter AWS ID:"},
-			Validate: validateLength("AWS Secret", 20),
-		},
-		{
-			Name:     "Secret",
-			Prompt:   &survey.Input{Message: "Enter AWS Secret:"},
-			Validate: validateLength("AWS Secret", 40),
-		},
+	creds := config.AWSCredentials{}
+	if err := survey.AskOne(&survey.Select{
+		Message: "Select AWS credentials source:",
+		Options: config.CredentialSources,
+		Default: cfg.AWSCredentials.GetSource(),
+	}, &creds.Source, nil); err != nil {
+		return err
 	}
 
-	return survey.Ask(prompts, &cfg.AWSCredentials)
+	prompts := []*survey.Question{}
+	switch creds.Source {
+	case config.CredentialSourceStatic:
+		prompts = append(prompts,
+			&survey.Question{
+				Name:     "ID",
+				Prompt:   &survey.Input{Message: "Enter AWS ID:"},
+				Validate: validateLength("AWS ID", 20),
+			},
+			&survey.Question{
+				Name:     "Secret",
+				Prompt:   &survey.Input{Message: "Enter AWS Secret:"},
+				Validate: validateLength("AWS Secret", 40),
+			},
+		)
+	case config.CredentialSourceProfile:
+		prompts = append(prompts, &survey.Question{
+			Name:     "Profile",
+			Prompt:   &survey.Input{Message: "Enter AWS profile name:", Default: cfg.AWSCredentials.Profile},
+			Validate: survey.Required,
+		})
+	case config.CredentialSourceAssumeRole:
+		prompts = append(prompts,
+			&survey.Question{
+				Name:     "RoleARN",
+				Prompt:   &survey.Input{Message: "Enter role ARN:", Default: cfg.AWSCredentials.RoleARN},
+				Validate: survey.Required,
+			},
+			&survey.Question{
+				Name:   "ExternalID",
+				Prompt: &survey.Input{Message: "Enter external ID (optional):", Default: cfg.AWSCredentials.ExternalID},
+			},
+			&survey.Question{
+				Name:   "MFASerial",
+				Prompt: &survey.Input{Message: "Enter MFA device serial number or ARN (optional):", Default: cfg.AWSCredentials.MFASerial},
+			},
+			&survey.Question{
+				Name:   "Profile",
+				Prompt: &survey.Input{Message: "Enter source profile name (optional):", Default: cfg.AWSCredentials.Profile},
+			},
+		)
+	}
+
+	if err := survey.Ask(prompts, &creds); err != nil {
+		return err
+	}
+
+	cfg.AWSCredentials = creds
+	return nil
+}
+
+// getRegions runs regions configuration.
+func getRegions(cfg *config.Config) error {
+	fmt.Println(info, "Discovering enabled regions...")
+
+	ctx, cancel := discoveryContext()
+	defer cancel()
+
+	discoverer, ok := newProvider(cfg, true).(core.RegionDiscoverer)
+	if !ok {
+		return errors.New("region discovery not supported by the server provider")
+	}
+
+	available, err := discoverer.DiscoverRegions(ctx)
+	if err != nil {
+		return fmt.Errorf("error discovering regions: %v", err)
+	}
+
+	surveyCore.QuestionIcon = "?"
+	autoDiscover := false
+	if err = survey.AskOne(&survey.Confirm{
+		Message: "Use all the regions enabled in the AWS account?",
+		Default: cfg.GetAutoDiscoverRegions(),
+	}, &autoDiscover, nil); err != nil {
+		return err
+	}
+
+	selected := available
+	if !autoDiscover {
+		if err = survey.AskOne(&survey.MultiSelect{
+			Message:  "Select regions:",
+			Options:  available,
+			Default:  cfg.RegionNames(),
+			PageSize: 10,
+		}, &selected, survey.Required); err != nil {
+			return err
+		}
+	}
+
+	noBastionDefault := []string{}
+	for _, region := range cfg.GetRegions() {
+		if region.NoBastion {
+			noBastionDefault = append(noBastionDefault, region.Name)
+		}
+	}
+
+	noBastion := []string{}
+	if err = survey.AskOne(&survey.MultiSelect{
+		Message:  "Select regions reachable without a bastion host (e.g. over VPN):",
+		Options:  selected,
+		Default:  noBastionDefault,
+		PageSize: 10,
+	}, &noBastion, nil); err != nil {
+		return err
+	}
+
+	isNoBastion := map[string]bool{}
+	for _, region := range noBastion {
+		isNoBastion[region] = true
+	}
+
+	cfg.AutoDiscoverRegions = &autoDiscover
+	cfg.Regions = []config.RegionConfig{}
+	for _, region := range selected {
+		cfg.Regions = append(cfg.Regions, config.RegionConfig{
+			Name:      region,
+			NoBastion: isNoBastion[region],
+		})
+	}
+
+	return nil
 }
 
 // getVPNConfig runs vpn configuration.
 func getVPNConfig(cfg *config.Config) error {
+	// The replaced secret is removed from the secret store.
+	if err := cfg.ReadSecrets(); err != nil {
+		return err
+	}
+
 	pritunl, err := vpn.NewPritunl()
 	if err != nil {
 		return err
@@ -182,45 +492,28 @@ func getVPNConfig(cfg *config.Config) error {
 func getBastionHosts(cfg *config.Config) error {
 	fmt.Println(info, "Updating bastion hosts list...")
 
-	typeFilter := core.NewFilter(core.TagType, []string{"bastion"}, core.Equals, false)
-	servers, err := core.GetAllServers(cfg.AWSCredentials, core.AllowedRegions, typeFilter)
+	ctx, cancel := discoveryContext()
+	defer cancel()
+
+	provider := newProvider(cfg, true)
+	regions, err := configuredRegions(ctx, cfg, provider)
 	if err != nil {
 		return err
 	}
 
-	if len(servers) == 0 {
-		return errors.New("no servers found")
+	bastionHosts, err := discoverBastionHosts(ctx, cfg, provider, regions)
+	if err != nil {
+		return err
 	}
 
-	cfg.BastionHosts = make(map[string][]string)
-	for _, server := range servers {
-		cfg.BastionHosts[server.Region] = append(cfg.BastionHosts[server.Region], server.PublicIP)
+	if len(bastionHosts) == 0 {
+		return errors.New("no servers found")
 	}
 
+	cfg.BastionHosts = bastionHosts
 	return nil
 }
 
-// checkConfigStatus checks the current configuration status.
-func checkConfigStatus() {
-	awsCredentialsStatus, bastionHostsStatus, vpnConfigStatus := failure, failure, failure
-
-	if cfg, err := config.LoadFromFile(); err == nil {
-		if cfg.AWSCredentials.ID != "" && cfg.AWSCredentials.Secret != "" {
-			awsCredentialsStatus = success
-		}
-		if len(cfg.BastionHosts) > 0 {
-			bastionHostsStatus = success
-		}
-		if cfg.VPNConfig.ProfileID != "" {
-			vpnConfigStatus = success
-		}
-	}
-
-	fmt.Println(awsCredentialsStatus, "AWS credentials configuration")
-	fmt.Println(bastionHostsStatus, "Bastion hosts configuration")
-	fmt.Println(vpnConfigStatus, "VPN configuration")
-}
-
 // validateLength validates the prompts input value length.
 func validateLength(label string, length int) func(interface{}) error {
 	return func(val interface{}) error {
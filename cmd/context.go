@@ -0,0 +1,181 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/gr00by87/fst/config"
+	"github.com/spf13/cobra"
+)
+
+var (
+	contextCopyFrom *string
+
+	// contextCmd represents the context command.
+	contextCmd = &cobra.Command{
+		Use:   "context",
+		Short: "Manage config contexts",
+		Long:  "This subcommand manages config contexts. Each context stores a separate configuration (AWS credentials, bastion hosts and VPN), e.g. one per AWS account.",
+	}
+
+	// contextListCmd represents the context list command.
+	contextListCmd = &cobra.Command{
+		Use:   "list",
+		Args:  cobra.NoArgs,
+		Short: "List config contexts",
+		Long:  "This subcommand lists the available config contexts, the current one is marked with `*`.",
+		Run:   runContextList,
+	}
+
+	// contextUseCmd represents the context use command.
+	contextUseCmd = &cobra.Command{
+		Use:   "use <name>",
+		Args:  cobra.ExactArgs(1),
+		Short: "Switch the current context",
+		Long:  "This subcommand sets the context used by all the subcommands when --context flag is not passed.",
+		Run:   runContextUse,
+	}
+
+	// contextAddCmd represents the context add command.
+	contextAddCmd = &cobra.Command{
+		Use:   "add <name>",
+		Args:  cobra.ExactArgs(1),
+		Short: "Add a new context",
+		Long:  "This subcommand adds a new, empty context, or a copy of an existing one if --from flag is passed. Use `fst --context <name> config` to configure it.",
+		Run:   runContextAdd,
+	}
+
+	// contextRemoveCmd represents the context remove command.
+	contextRemoveCmd = &cobra.Command{
+		Use:   "remove <name>",
+		Args:  cobra.ExactArgs(1),
+		Short: "Remove a context",
+		Long:  "This subcommand removes a context. The current context cannot be removed.",
+		Run:   runContextRemove,
+	}
+)
+
+// init initializes the cobra command and flags.
+func init() {
+	rootCmd.AddCommand(contextCmd)
+	contextCmd.AddCommand(contextListCmd)
+	contextCmd.AddCommand(contextUseCmd)
+	contextCmd.AddCommand(contextAddCmd)
+	contextCmd.AddCommand(contextRemoveCmd)
+	contextCopyFrom = contextAddCmd.Flags().String("from", "", "copy the configuration of an existing context")
+}
+
+// runContextList executes the context list command.
+func runContextList(_ *cobra.Command, _ []string) {
+	f := loadConfigFile()
+
+	names := []string{}
+	for name := range f.Contexts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "CURRENT\tNAME")
+	for _, name := range names {
+		current := ""
+		if name == f.CurrentContext {
+			current = "*"
+		}
+		fmt.Fprintf(w, "%s\t%s\n", current, name)
+	}
+	w.Flush()
+}
+
+// runContextUse executes the context use command.
+func runContextUse(_ *cobra.Command, args []string) {
+	f := loadConfigFile()
+
+	if _, ok := f.Contexts[args[0]]; !ok {
+		exitWithError(fmt.Errorf("context not found: %s", args[0]))
+	}
+
+	f.CurrentContext = args[0]
+	if err := config.SaveFile(f); err != nil {
+		exitWithError(err)
+	}
+
+	fmt.Println(success, "Switched to context", args[0])
+}
+
+// runContextAdd executes the context add command.
+func runContextAdd(_ *cobra.Command, args []string) {
+	f, err := config.LoadFile()
+	if config.IsNotExist(err) {
+		f = &config.File{
+			CurrentContext: args[0],
+			Contexts:       map[string]*config.Config{},
+		}
+	} else if err != nil {
+		exitWithError(err)
+	}
+
+	if _, ok := f.Contexts[args[0]]; ok {
+		exitWithError(fmt.Errorf("context already exists: %s", args[0]))
+	}
+
+	cfg := &config.Config{}
+	if *contextCopyFrom != "" {
+		from, ok := f.Contexts[*contextCopyFrom]
+		if !ok {
+			exitWithError(fmt.Errorf("context not found: %s", *contextCopyFrom))
+		}
+		copied := *from
+		if err = config.LoadSecrets(&copied, *contextCopyFrom); err != nil {
+			exitWithError(err)
+		}
+		cfg = &copied
+	}
+
+	f.Contexts[args[0]] = cfg
+	if err := config.SaveFile(f); err != nil {
+		exitWithError(err)
+	}
+
+	fmt.Println(success, "Context", args[0], "added successfully")
+	fmt.Println(info, fmt.Sprintf("Use `fst --context %s config` to configure it", args[0]))
+}
+
+// runContextRemove executes the context remove command.
+func runContextRemove(_ *cobra.Command, args []string) {
+	f := loadConfigFile()
+
+	if _, ok := f.Contexts[args[0]]; !ok {
+		exitWithError(fmt.Errorf("context not found: %s", args[0]))
+	}
+	if args[0] == f.CurrentContext {
+		exitWithError(errors.New("cannot remove the current context, use `fst context use` to switch to another one first"))
+	}
+
+	if !proceed(fmt.Sprintf("This will remove %s context configuration, do you want to proceed?", args[0])) {
+		return
+	}
+
+	if err := config.DeleteSecrets(f.Contexts[args[0]], args[0]); err != nil {
+		exitWithError(err)
+	}
+
+	delete(f.Contexts, args[0])
+	if err := config.SaveFile(f); err != nil {
+		exitWithError(err)
+	}
+
+	fmt.Println(success, "Context", args[0], "removed successfully")
+}
+
+// loadConfigFile loads the config file. Exits with error if it fails.
+func loadConfigFile() *config.File {
+	f, err := config.LoadFile()
+	if err != nil {
+		exitWithError(err)
+	}
+	return f
+}
@@ -0,0 +1,146 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines printed around the changes.
+const diffContext = 3
+
+// diffLine stores a single line of the diff, prefixed with ' ' if it's
+// unchanged, '-' if it's removed and '+' if it's added.
+type diffLine struct {
+	op   byte
+	text string
+}
+
+// unifiedDiff returns the changes between the before and after content of the
+// file in the unified diff format.
+func unifiedDiff(path, before, after string) string {
+	lines := diffLines(splitLines(before), splitLines(after))
+
+	// Line numbers of the old and the new content for every diff line.
+	oldNums, newNums := make([]int, len(lines)+1), make([]int, len(lines)+1)
+	for i, line := range lines {
+		oldNums[i+1], newNums[i+1] = oldNums[i], newNums[i]
+		if line.op != '+' {
+			oldNums[i+1]++
+		}
+		if line.op != '-' {
+			newNums[i+1]++
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "--- %s\n+++ %s\n", path, path)
+
+	for i := 0; i < len(lines); {
+		for i < len(lines) && lines[i].op == ' ' {
+			i++
+		}
+		if i == len(lines) {
+			break
+		}
+
+		start, end := i-diffContext, i
+		if start < 0 {
+			start = 0
+		}
+
+		// Merge the changes separated by less than twice the context.
+		for end < len(lines) {
+			if lines[end].op != ' ' {
+				end++
+				continue
+			}
+
+			next := end
+			for next < len(lines) && lines[next].op == ' ' {
+				next++
+			}
+			if next == len(lines) || next-end > 2*diffContext {
+				end += diffContext
+				if end > len(lines) {
+					end = len(lines)
+				}
+				break
+			}
+			end = next
+		}
+
+		fmt.Fprintf(buf, "@@ -%s +%s @@\n",
+			hunkRange(oldNums[start], oldNums[end]-oldNums[start]),
+			hunkRange(newNums[start], newNums[end]-newNums[start]),
+		)
+		for _, line := range lines[start:end] {
+			fmt.Fprintf(buf, "%c%s\n", line.op, line.text)
+		}
+		i = end
+	}
+
+	return buf.String()
+}
+
+// diffLines returns the shortest edit script turning a lines into b lines,
+// based on their longest common subsequence.
+func diffLines(a, b []string) []diffLine {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			switch {
+			case a[i] == b[j]:
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	lines := []diffLine{}
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			lines = append(lines, diffLine{' ', a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			lines = append(lines, diffLine{'-', a[i]})
+			i++
+		default:
+			lines = append(lines, diffLine{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		lines = append(lines, diffLine{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		lines = append(lines, diffLine{'+', b[j]})
+	}
+	return lines
+}
+
+// hunkRange formats the hunk line range, start is the number of lines before
+// the hunk.
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+// splitLines splits the content into lines, without the line endings.
+func splitLines(content string) []string {
+	if content == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+}
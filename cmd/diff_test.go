@@ -0,0 +1,61 @@
+package cmd
+
+import "testing"
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name   string
+		before string
+		after  string
+		want   string
+	}{
+		{
+			name:   "new file",
+			before: "",
+			after:  "a\nb\n",
+			want:   "--- config\n+++ config\n@@ -0,0 +1,2 @@\n+a\n+b\n",
+		},
+		{
+			name:   "removed content",
+			before: "a\nb\n",
+			after:  "",
+			want:   "--- config\n+++ config\n@@ -1,2 +0,0 @@\n-a\n-b\n",
+		},
+		{
+			name:   "no changes",
+			before: "a\nb\n",
+			after:  "a\nb\n",
+			want:   "--- config\n+++ config\n",
+		},
+		{
+			name:   "changed line with context",
+			before: "1\n2\n3\n4\n5\n6\n7\n8\n9\n",
+			after:  "1\n2\n3\n4\nfive\n6\n7\n8\n9\n",
+			want:   "--- config\n+++ config\n@@ -2,7 +2,7 @@\n 2\n 3\n 4\n-5\n+five\n 6\n 7\n 8\n",
+		},
+		{
+			name:   "appended lines",
+			before: "1\n2\n3\n4\n5\n",
+			after:  "1\n2\n3\n4\n5\n6\n",
+			want:   "--- config\n+++ config\n@@ -3,3 +3,4 @@\n 3\n 4\n 5\n+6\n",
+		},
+		{
+			name:   "close changes are merged",
+			before: "1\n2\n3\n4\n5\n6\n7\n8\n",
+			after:  "one\n2\n3\n4\n5\n6\n7\neight\n",
+			want:   "--- config\n+++ config\n@@ -1,8 +1,8 @@\n-1\n+one\n 2\n 3\n 4\n 5\n 6\n 7\n-8\n+eight\n",
+		},
+		{
+			name:   "distant changes are split",
+			before: "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n",
+			after:  "one\n2\n3\n4\n5\n6\n7\n8\n9\nten\n",
+			want:   "--- config\n+++ config\n@@ -1,4 +1,4 @@\n-1\n+one\n 2\n 3\n 4\n@@ -7,4 +7,4 @@\n 7\n 8\n 9\n-10\n+ten\n",
+		},
+	}
+
+	for _, tt := range tests {
+		if got := unifiedDiff("config", tt.before, tt.after); got != tt.want {
+			t.Errorf("%s: unifiedDiff() =\n%s\nwant\n%s", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package cmd
+
+import (
+	"encoding/base32"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/gr00by87/fst/config"
+	"github.com/gr00by87/fst/core"
+	"github.com/gr00by87/fst/vpn"
+	"github.com/spf13/cobra"
+)
+
+// doctor check statuses.
+const (
+	checkPass = "pass"
+	checkFail = "fail"
+	checkSkip = "skip"
+)
+
+var (
+	doctorOutput *string
+
+	// doctorCmd represents the doctor command.
+	doctorCmd = &cobra.Command{
+		Use:   "doctor",
+		Args:  cobra.NoArgs,
+		Short: "Check configuration and environment",
+		Long:  "This subcommand verifies the configuration: the AWS credentials are valid and allowed to describe instances, the stored bastion hosts are reachable, ssh and scp commands are installed and, if VPN is configured, the Pritunl client is running, the profile exists and the OTP secret is valid. Exits with code 1 if any check fails.",
+		Run:   runDoctor,
+	}
+)
+
+// checkResult stores the result of a single doctor check.
+type checkResult struct {
+	Check   string `json:"check"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
+
+// init initializes the cobra command and flags.
+func init() {
+	rootCmd.AddCommand(doctorCmd)
+	doctorOutput = doctorCmd.Flags().StringP("output", "o", outputTable, "output format, one of: table,json")
+}
+
+// runDoctor executes the doctor command.
+func runDoctor(_ *cobra.Command, _ []string) {
+	if *doctorOutput != outputTable && *doctorOutput != outputJSON {
+		exitWithError(fmt.Errorf("invalid output format: %s, one of: table,json", *doctorOutput))
+	}
+
+	results := []checkResult{}
+	cfg, err := config.LoadFromFile()
+	results = append(results, checkConfigFile(err))
+	if err == nil {
+		results = append(results, checkAWS(cfg)...)
+		results = append(results, checkBastions(cfg)...)
+	}
+	results = append(results, checkBinary("ssh"), checkBinary("scp"))
+	if err == nil {
+		results = append(results, checkVPN(cfg)...)
+	}
+
+	if *doctorOutput == outputJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(results); err != nil {
+			exitWithError(err)
+		}
+	} else {
+		printCheckResults(results)
+	}
+
+	for _, result := range results {
+		if result.Status == checkFail {
+			os.Exit(1)
+		}
+	}
+}
+
+// newCheckResult creates the check result, failed if err is not nil.
+func newCheckResult(check, message string, err error) checkResult {
+	if err != nil {
+		return checkResult{Check: check, Status: checkFail, Message: strings.Replace(err.Error(), "\n", " ", -1)}
+	}
+	return checkResult{Check: check, Status: checkPass, Message: message}
+}
+
+// checkConfigFile checks the result of loading the config file.
+func checkConfigFile(err error) checkResult {
+	path, pathErr := config.FilePath()
+	if pathErr != nil {
+		return newCheckResult("config file", "", pathErr)
+	}
+	return newCheckResult("config file", path, err)
+}
+
+// checkAWS checks the AWS credentials are valid and allowed to describe the
+// instances of the first configured region.
+func checkAWS(cfg *config.Config) []checkResult {
+	ctx, cancel := discoveryContext()
+	defer cancel()
+
+	provider := core.NewEC2Provider(cfg.AWSCredentials)
+	arn, err := provider.CallerIdentity(ctx)
+	results := []checkResult{newCheckResult("aws credentials", arn, err)}
+
+	const check = "ec2:DescribeInstances"
+	if err != nil {
+		return append(results, checkResult{Check: check, Status: checkSkip, Message: "aws credentials not valid"})
+	}
+
+	region := cfg.RegionNames()[0]
+	err = provider.CheckDescribeInstances(ctx, region)
+	return append(results, newCheckResult(check, "allowed in "+region, err))
+}
+
+// checkBastions checks the stored bastion hosts are reachable on the ssh port.
+func checkBastions(cfg *config.Config) []checkResult {
+	if len(cfg.BastionHosts) == 0 {
+		return []checkResult{{Check: "bastion hosts", Status: checkSkip, Message: "no bastion hosts stored"}}
+	}
+
+	regions := []string{}
+	for region := range cfg.BastionHosts {
+		regions = append(regions, region)
+	}
+	sort.Strings(regions)
+
+	results := []checkResult{}
+	selector := newBastionSelector(cfg)
+	for _, region := range regions {
+		for _, status := range selector.Probe(cfg.BastionAddresses(region, "")) {
+			check := fmt.Sprintf("bastion %s %s", region, status.Host)
+			results = append(results, newCheckResult(check, fmt.Sprintf("reachable in %s", status.Latency.Round(time.Millisecond)), status.Err))
+		}
+	}
+	return results
+}
+
+// checkBinary checks the command is installed.
+func checkBinary(name string) checkResult {
+	path, err := exec.LookPath(name)
+	return newCheckResult(name, path, err)
+}
+
+// checkVPN checks the Pritunl client is running, the profile exists and the
+// OTP secret is valid.
+func checkVPN(cfg *config.Config) []checkResult {
+	checks := []string{"pritunl socket", "pritunl auth key", "vpn profile", "otp secret"}
+	if cfg.VPNConfig.ProfileID == "" {
+		results := []checkResult{}
+		for _, check := range checks {
+			results = append(results, checkResult{Check: check, Status: checkSkip, Message: "vpn not configured"})
+		}
+		return results
+	}
+
+	results := []checkResult{
+		newCheckResult(checks[0], "reachable", vpn.CheckSocket()),
+		newCheckResult(checks[1], "readable", vpn.CheckAuthKey()),
+		newCheckResult(checks[2], cfg.VPNConfig.ProfileID, checkVPNProfile(cfg.VPNConfig.ProfileID)),
+	}
+
+	otpSecret, err := cfg.VPNConfig.GetOTPSecret()
+	if err != nil {
+		return append(results, newCheckResult(checks[3], "", err))
+	}
+	if otpSecret == "" {
+		return append(results, checkResult{Check: checks[3], Status: checkSkip, Message: "not set, the otp code is prompted for"})
+	}
+	return append(results, newCheckResult(checks[3], "valid", checkOTPSecret(otpSecret)))
+}
+
+// checkVPNProfile checks the Pritunl profile exists.
+func checkVPNProfile(id string) error {
+	pritunl, err := vpn.NewPritunl()
+	if err != nil {
+		return err
+	}
+
+	profiles, err := pritunl.ListProfiles()
+	if err != nil {
+		return err
+	}
+
+	for _, profile := range profiles {
+		if profile.ID == id {
+			return nil
+		}
+	}
+	return fmt.Errorf("profile not found: %s, use `fst config -v` to select another one", id)
+}
+
+// checkOTPSecret checks the OTP secret is a valid base32 string.
+func checkOTPSecret(secret string) error {
+	secret = strings.ToUpper(secret)
+	if n := len(secret) % 8; n != 0 {
+		secret += strings.Repeat("=", 8-n)
+	}
+
+	if _, err := base32.StdEncoding.DecodeString(secret); err != nil {
+		return errors.New("invalid base32 encoding")
+	}
+	return nil
+}
+
+// printCheckResults prints the doctor check results.
+func printCheckResults(results []checkResult) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "\tCHECK\tSTATUS\tMESSAGE")
+	for _, result := range results {
+		symbol := success
+		switch result.Status {
+		case checkFail:
+			symbol = failure
+		case checkSkip:
+			symbol = warning
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", symbol, result.Check, result.Status, result.Message)
+	}
+	w.Flush()
+}
@@ -0,0 +1,282 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/gr00by87/fst/core"
+	"github.com/gr00by87/fst/sshclient"
+	"github.com/spf13/cobra"
+)
+
+var (
+	execFlags        filterFlags
+	execParallel     *int
+	execOutput       *string
+	execLoginName    *string
+	execIdentityFile *string
+	execNative       *bool
+
+	// execCmd represents the exec command.
+	execCmd = &cobra.Command{
+		Use:   "exec [flags] -- <command>",
+		Args:  cobra.MinimumNArgs(1),
+		Short: "Run a command on many instances in parallel",
+		Long:  "This subcommand runs a command on all the servers matching the filters, the same ones as in list-servers subcommand. Each output line is prefixed with the server name and an exit status summary is printed at the end.",
+		Run:   runExec,
+	}
+)
+
+// execResult stores the result of running the command on a single server.
+type execResult struct {
+	Name     string `json:"name"`
+	Region   string `json:"region"`
+	IP       string `json:"ip"`
+	ExitCode int    `json:"exit_code"`
+	Error    string `json:"error,omitempty"`
+	Stdout   string `json:"stdout"`
+	Stderr   string `json:"stderr"`
+}
+
+// jump stores the bastion host selected for a region and VPC.
+type jump struct {
+	host string
+	err  error
+}
+
+// init initializes the cobra command and flags.
+func init() {
+	rootCmd.AddCommand(execCmd)
+	addFilterFlags(execCmd, &execFlags)
+	execParallel = execCmd.Flags().IntP("parallel", "p", 10, "maximum number of servers the command runs on at the same time")
+	execOutput = execCmd.Flags().StringP("output", "o", "text", "output format, one of: text,json")
+	execLoginName = execCmd.Flags().StringP("login-name", "l", "", "login user name")
+	execIdentityFile = execCmd.Flags().String("identity-file", "", "identity file location")
+	execNative = execCmd.Flags().Bool("native", false, "use the built-in ssh client instead of the system ssh command")
+}
+
+// runExec executes the exec command.
+func runExec(_ *cobra.Command, args []string) {
+	if *execOutput != "text" && *execOutput != outputJSON {
+		exitWithError(fmt.Errorf("invalid output format: %s, one of: text,json", *execOutput))
+	}
+	if *execParallel < 1 {
+		exitWithError(errors.New("parallel must be greater than 0"))
+	}
+
+	cfg := checkBastionHosts()
+	servers := filterServers(cfg, execFlags)
+	if len(servers) == 0 {
+		exitWithError(errors.New("no servers found"))
+	}
+
+	// Select the bastion hosts up front, so every region and VPC is probed
+	// once.
+	ctx, cancel := discoveryContext()
+	defer cancel()
+
+	provider := newProvider(cfg, false)
+	jumps := map[string]jump{}
+	for _, server := range servers {
+		key := server.Region + "/" + server.VPCID
+		if _, ok := jumps[key]; !ok {
+			host, err := jumpHost(ctx, cfg, provider, server)
+			jumps[key] = jump{host: host, err: err}
+		}
+	}
+
+	command := strings.Join(args, " ")
+	results := make([]execResult, len(servers))
+	sem := make(chan struct{}, *execParallel)
+	stdout := &lockedWriter{w: os.Stdout}
+	wg := sync.WaitGroup{}
+
+	for i := range servers {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			server := servers[i]
+			results[i] = execOnServer(server, jumps[server.Region+"/"+server.VPCID], command, stdout)
+		}(i)
+	}
+	wg.Wait()
+
+	failed := false
+	for _, result := range results {
+		if result.ExitCode != 0 || result.Error != "" {
+			failed = true
+		}
+	}
+
+	if *execOutput == outputJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(results); err != nil {
+			exitWithError(err)
+		}
+	} else {
+		printExecSummary(results)
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// execOnServer runs the command on the server. In text output mode, the
+// command output is streamed to stdout with each line prefixed with the
+// server name, otherwise it's stored in the result.
+func execOnServer(server core.Server, jump jump, command string, stdout *lockedWriter) execResult {
+	result := execResult{
+		Name:   server.Name,
+		Region: server.Region,
+		IP:     server.PrivateIP,
+	}
+
+	var outBuf, errBuf bytes.Buffer
+	var outWriter, errWriter io.Writer = &outBuf, &errBuf
+	if *execOutput != outputJSON {
+		prefix := fmt.Sprintf("%s | ", serverLabel(server))
+		out := &prefixWriter{w: stdout, prefix: prefix}
+		defer out.Flush()
+		outWriter, errWriter = out, out
+	}
+
+	if jump.err != nil {
+		result.ExitCode, result.Error = -1, jump.err.Error()
+		return result
+	}
+
+	var err error
+	if *execNative {
+		result.ExitCode, err = execNativeSSH(jump.host, server.PrivateIP, command, outWriter, errWriter)
+	} else {
+		result.ExitCode, err = execSystemSSH(jump.host, server.PrivateIP, command, outWriter, errWriter)
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+
+	result.Stdout, result.Stderr = outBuf.String(), errBuf.String()
+	return result
+}
+
+// execSystemSSH runs the command using the system ssh command.
+func execSystemSSH(bastion, host, command string, stdout, stderr io.Writer) (int, error) {
+	argv := []string{"-o", "BatchMode=yes"}
+	if bastion != "" {
+		argv = append(argv, "-J", bastion)
+	}
+	if *execLoginName != "" {
+		argv = append(argv, "-l", *execLoginName)
+	}
+	if *execIdentityFile != "" {
+		argv = append(argv, "-i", *execIdentityFile)
+	}
+	argv = append(argv, host, command)
+
+	cmd := exec.Command("ssh", argv...)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	err := cmd.Run()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return exitErr.ExitCode(), nil
+	}
+	if err != nil {
+		return -1, err
+	}
+	return 0, nil
+}
+
+// execNativeSSH runs the command using the built-in ssh client.
+func execNativeSSH(bastion, host, command string, stdout, stderr io.Writer) (int, error) {
+	client, err := sshclient.Dial(sshclient.Config{
+		User:         *execLoginName,
+		IdentityFile: *execIdentityFile,
+	}, bastion, host)
+	if err != nil {
+		return -1, err
+	}
+	defer client.Close()
+
+	return client.Run(command, stdout, stderr)
+}
+
+// printExecSummary prints the exit status of the command on every server.
+func printExecSummary(results []execResult) {
+	fmt.Println()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "\tNAME\tIP\tEXIT CODE\tERROR")
+	for _, result := range results {
+		status := success
+		if result.ExitCode != 0 || result.Error != "" {
+			status = failure
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\n", status, result.Name, result.IP, result.ExitCode, result.Error)
+	}
+	w.Flush()
+}
+
+// serverLabel returns the server name, or its private ip if it has no name.
+func serverLabel(server core.Server) string {
+	if server.Name != "" {
+		return server.Name
+	}
+	return server.PrivateIP
+}
+
+// lockedWriter is a writer safe for concurrent use.
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// Write implements the io.Writer interface.
+func (l *lockedWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(p)
+}
+
+// prefixWriter writes complete lines prefixed with the prefix.
+type prefixWriter struct {
+	w      io.Writer
+	prefix string
+	buf    []byte
+}
+
+// Write implements the io.Writer interface.
+func (p *prefixWriter) Write(data []byte) (int, error) {
+	p.buf = append(p.buf, data...)
+	for {
+		i := bytes.IndexByte(p.buf, '\n')
+		if i < 0 {
+			break
+		}
+		if _, err := p.w.Write(append([]byte(p.prefix), p.buf[:i+1]...)); err != nil {
+			return 0, err
+		}
+		p.buf = p.buf[i+1:]
+	}
+	return len(data), nil
+}
+
+// Flush writes the remaining incomplete line.
+func (p *prefixWriter) Flush() {
+	if len(p.buf) > 0 {
+		p.Write([]byte("\n"))
+	}
+}
@@ -4,20 +4,29 @@ import (
 	"fmt"
 	"os"
 	"strings"
-	"text/tabwriter"
 
 	"github.com/gr00by87/fst/config"
 	"github.com/gr00by87/fst/core"
 	"github.com/spf13/cobra"
-	"github.com/spf13/pflag"
 )
 
-// flags stores list-servers command flag variables.
-type flags struct {
+// filterFlags stores the server filter flag variables.
+type filterFlags struct {
 	name       *[]string
 	env        *[]string
 	region     *[]string
+	tag        *[]string
+	filter     *string
 	ignoreCase *bool
+	refresh    *bool
+}
+
+// flags stores list-servers command flag variables.
+type flags struct {
+	filterFlags
+	output  *string
+	columns *[]string
+	sortBy  *[]string
 }
 
 var (
@@ -28,7 +37,7 @@ var (
 	listServersCmd = &cobra.Command{
 		Use:   "list-servers",
 		Short: "List available servers",
-		Long:  "This subcommand lists available servers from selected AWS region(s), filtered by Name and Env tags.",
+		Long:  "This subcommand lists available servers from selected AWS region(s), filtered by tags.",
 		Run: func(cmd *cobra.Command, args []string) {
 			runListServers(cmd, args, listServersFlags)
 		},
@@ -38,7 +47,7 @@ var (
 	lsCmd = &cobra.Command{
 		Use:   "ls",
 		Short: "List available servers (alias of list-servers)",
-		Long:  "This subcommand lists available servers from selected AWS region(s), filtered by Name and Env tags.",
+		Long:  "This subcommand lists available servers from selected AWS region(s), filtered by tags.",
 		Run: func(cmd *cobra.Command, args []string) {
 			runListServers(cmd, args, lsFlags)
 		},
@@ -56,22 +65,26 @@ func init() {
 
 // addFlags adds the default list-servers command flags.
 func addFlags(cmd *cobra.Command, f *flags) {
+	addFilterFlags(cmd, &f.filterFlags)
+	f.output = cmd.Flags().StringP("output", "o", outputTable, "output format, one of: table,wide,json,yaml,csv,name,go-template=... (the template is executed for every server)")
+	f.columns = cmd.Flags().StringSliceP("columns", "c", []string{}, fmt.Sprintf("columns to print in table and csv outputs, any of: %s", strings.Join(columnNames(), ",")))
+	f.sortBy = cmd.Flags().StringSliceP("sort-by", "s", []string{}, "sort servers by columns, prefix a column with - to sort in descending order")
+}
+
+// addFilterFlags adds the server filter flags.
+func addFilterFlags(cmd *cobra.Command, f *filterFlags) {
+	f.region = cmd.Flags().StringSliceP("region", "r", []string{}, "look for servers in selected AWS region(s), any of the configured regions or all, defaults to the first configured region")
+	addTagFilterFlags(cmd, f)
+}
+
+// addTagFilterFlags adds the server filter flags, except the region one.
+func addTagFilterFlags(cmd *cobra.Command, f *filterFlags) {
 	f.name = cmd.Flags().StringSliceP("name", "n", []string{}, "filter servers by Name tag, multiple comma separated values are allowed")
 	f.env = cmd.Flags().StringSliceP("env", "e", []string{}, "filter servers by Env tag, multiple comma separated values are allowed")
-	f.region = cmd.Flags().StringSliceP("region", "r", []string{"us-east-1"}, "look for servers in selected AWS region(s), any of: us-east-1,us-west-2,eu-west-1,ap-northeast-1,ap-southeast-2,all")
+	f.tag = cmd.Flags().StringArrayP("tag", "t", []string{}, "filter servers by tag comparison, e.g. Team=payments or 'Role~=worker', can be repeated")
+	f.filter = cmd.Flags().StringP("filter", "f", "", fmt.Sprintf("filter servers by expression, e.g. 'env=prod and (type=api or type=worker)', supported operators: = (equals), *= (contains), ~= (regex), %%= (glob), each can be negated with !, besides tags the following attributes can be compared: %s", strings.Join(core.Attributes, ",")))
 	f.ignoreCase = cmd.Flags().BoolP("ignore-case", "i", false, "ignore case in tag filters")
-
-	// Remove confusing `[]` symbols from region's default value.
-	cmd.Flags().VisitAll(func(flag *pflag.Flag) {
-		if flag.Name == "region" {
-			flag.DefValue = strings.Map(func(r rune) rune {
-				if r == '[' || r == ']' {
-					return '"'
-				}
-				return r
-			}, flag.DefValue)
-		}
-	})
+	f.refresh = cmd.Flags().Bool("refresh", false, "bypass the server inventory cache")
 }
 
 // runListServers executes the list-servers command.
@@ -81,46 +94,46 @@ func runListServers(cmd *cobra.Command, _ []string, f flags) {
 		exitWithError(err)
 	}
 
-	regions, err := checkRegions(*f.region)
-	if err != nil {
+	servers := filterServers(cfg, f.filterFlags)
+
+	if err = sortServers(servers, *f.sortBy); err != nil {
 		exitWithError(err)
 	}
 
-	nameFilter := core.NewFilter(core.TagName, *f.name, core.Contains, *f.ignoreCase)
-	envFilter := core.NewFilter(core.TagEnv, *f.env, core.Equals, *f.ignoreCase)
-	servers, err := core.GetAllServers(cfg.AWSCredentials, regions, nameFilter, envFilter)
-	if err != nil {
+	if err = printServers(os.Stdout, servers, *f.output, *f.columns); err != nil {
 		exitWithError(err)
 	}
+}
+
+// filterServers retrieves the servers matching the filter flags. Exits with
+// error if it fails.
+func filterServers(cfg *config.Config, f filterFlags) []core.Server {
+	ctx, cancel := discoveryContext()
+	defer cancel()
 
-	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
-	fmt.Fprintln(w, "NAME\tENVIRONMENT\tPRIVATE IP\tPUBLIC IP")
-	for _, server := range servers {
-		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", server.Name, server.Env, server.PrivateIP, server.PublicIP)
+	provider := newProvider(cfg, *f.refresh)
+	allowedRegions, err := configuredRegions(ctx, cfg, provider)
+	if err != nil {
+		exitWithError(err)
 	}
-	w.Flush()
-}
 
-// checkRegions validates passed regions. If `all` is paseed, it returns all
-// the allowed regions. If any invalid region passed it returns an error.
-func checkRegions(regions []string) ([]string, error) {
-	if regions[0] == "all" {
-		return core.AllowedRegions, nil
+	regions, err := checkRegions(*f.region, allowedRegions)
+	if err != nil {
+		exitWithError(err)
 	}
 
-	for _, region := range regions {
-		isValid := false
-		for _, allowedRegion := range core.AllowedRegions {
-			if region == allowedRegion {
-				isValid = true
-				break
-			}
-		}
-
-		if !isValid {
-			return nil, fmt.Errorf("invalid region: %s", region)
-		}
+	matchers, err := parseMatchers(*f.tag, *f.filter, *f.ignoreCase)
+	if err != nil {
+		exitWithError(err)
 	}
 
-	return regions, nil
+	matchers = append(matchers,
+		core.NewFilter(core.TagName, *f.name, core.Contains, *f.ignoreCase),
+		core.NewFilter(core.TagEnv, *f.env, core.Equals, *f.ignoreCase),
+	)
+
+	servers, err := provider.ListServers(ctx, regions, matchers...)
+	checkDiscoveryError(err)
+
+	return servers
 }
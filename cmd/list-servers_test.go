@@ -0,0 +1,180 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/gr00by87/fst/config"
+	"github.com/gr00by87/fst/core"
+)
+
+// fakeProvider is a server inventory serving fixed servers.
+type fakeProvider struct {
+	servers []core.Server
+	failing map[string]bool
+}
+
+// ListServers implements the core.Provider interface.
+func (p *fakeProvider) ListServers(_ context.Context, regions []string, matchers ...core.Matcher) ([]core.Server, error) {
+	partialErr := &core.PartialError{}
+	servers := []core.Server{}
+	for _, region := range regions {
+		if p.failing[region] {
+			partialErr.Errors = append(partialErr.Errors, &core.RegionError{Region: region, Err: errors.New("access denied")})
+			continue
+		}
+		for _, server := range p.servers {
+			if server.Region == region && core.MatchAll(server, matchers...) {
+				servers = append(servers, server)
+			}
+		}
+	}
+
+	if len(partialErr.Errors) > 0 {
+		return servers, partialErr
+	}
+	return servers, nil
+}
+
+// FindServers implements the core.Provider interface.
+func (p *fakeProvider) FindServers(_ context.Context, regions []string, sid core.ServerID) ([]core.Server, error) {
+	servers := []core.Server{}
+	for _, server := range p.servers {
+		if sid.Matches(server) {
+			servers = append(servers, server)
+		}
+	}
+	return servers, nil
+}
+
+// testProvider is the inventory the commands run by runCommand list.
+var testProvider = &fakeProvider{
+	servers: []core.Server{
+		{Name: "api-1", Env: "prod", Type: "api", Region: "us-east-1", PrivateIP: "10.0.0.1"},
+		{Name: "worker-1", Env: "prod", Type: "worker", Region: "us-east-1", PrivateIP: "10.0.0.2"},
+		{Name: "api-2", Env: "staging", Type: "api", Region: "us-east-1", PrivateIP: "10.0.0.3"},
+		{Name: "api-3", Env: "prod", Type: "api", Region: "eu-west-1", PrivateIP: "10.1.0.1"},
+	},
+	failing: map[string]bool{"ap-south-1": true},
+}
+
+// runCommand runs the fst command with the args against testProvider and the
+// config file in a new process, as the commands exit on errors and their
+// flags keep the values between runs. Returns the command output and exit
+// code.
+func runCommand(t *testing.T, configData string, args ...string) (string, int) {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "fst-cmd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	configPath := filepath.Join(dir, "config.json")
+	if err = ioutil.WriteFile(configPath, []byte(configData), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command(os.Args[0], append([]string{"-test.run=TestCommandProcess", "--", "--config", configPath}, args...)...)
+	cmd.Env = append(os.Environ(), "FST_TEST_COMMAND=1")
+	output, err := cmd.Output()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return string(output), exitErr.ExitCode()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(output), 0
+}
+
+// TestCommandProcess runs the fst command for runCommand.
+func TestCommandProcess(t *testing.T) {
+	if os.Getenv("FST_TEST_COMMAND") != "1" {
+		return
+	}
+
+	newProvider = func(*config.Config, bool) core.Provider {
+		return testProvider
+	}
+
+	args := os.Args
+	for i, arg := range args {
+		if arg == "--" {
+			args = args[i+1:]
+			break
+		}
+	}
+
+	rootCmd.SetArgs(args)
+	if err := rootCmd.Execute(); err != nil {
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+func TestListServersCommand(t *testing.T) {
+	const configData = `{"version": 2, "current_context": "default", "contexts": {"default": {"regions": [{"name": "us-east-1"}, {"name": "eu-west-1"}, {"name": "ap-south-1"}]}}}`
+
+	tests := []struct {
+		name     string
+		args     []string
+		want     string
+		wantCode int
+	}{
+		{
+			name: "first region",
+			args: []string{"ls", "-o", "name"},
+			want: "api-1\nworker-1\napi-2\n",
+		},
+		{
+			name: "failing region is skipped",
+			args: []string{"ls", "-o", "name", "-r", "all"},
+			want: "api-1\nworker-1\napi-2\napi-3\n",
+		},
+		{
+			name: "filter expression",
+			args: []string{"ls", "-o", "name", "-r", "all", "-f", "env=prod and type=api"},
+			want: "api-1\napi-3\n",
+		},
+		{
+			name: "name and env filters",
+			args: []string{"list-servers", "-o", "name", "-n", "api", "-e", "prod"},
+			want: "api-1\n",
+		},
+		{
+			name: "table output",
+			args: []string{"ls", "-r", "eu-west-1", "-c", "name,env,private-ip"},
+			want: "NAME    ENVIRONMENT   PRIVATE IP\napi-3   prod          10.1.0.1\n",
+		},
+		{
+			name:     "invalid region",
+			args:     []string{"ls", "-r", "us-west-2"},
+			want:     "invalid region: us-west-2\n",
+			wantCode: 1,
+		},
+		{
+			name:     "invalid filter expression",
+			args:     []string{"ls", "-f", "(env=prod"},
+			want:     "invalid filter expression at position 10: missing closing parenthesis\n",
+			wantCode: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, code := runCommand(t, configData, tt.args...)
+			if code != tt.wantCode {
+				t.Errorf("fst %v exit code = %d, want %d, output:\n%s", tt.args, code, tt.wantCode, got)
+			}
+			if tt.want != "" && got != tt.want {
+				t.Errorf("fst %v output =\n%s\nwant\n%s", tt.args, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,239 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/alecthomas/template"
+	"github.com/gr00by87/fst/core"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// output formats.
+const (
+	outputTable      = "table"
+	outputWide       = "wide"
+	outputJSON       = "json"
+	outputYAML       = "yaml"
+	outputCSV        = "csv"
+	outputName       = "name"
+	outputGoTemplate = "go-template="
+)
+
+// column stores a server list column definition.
+type column struct {
+	name   string
+	header string
+	value  func(core.Server) string
+}
+
+var (
+	// columns stores all the available server list columns.
+	columns = []column{
+		{name: "name", header: "NAME", value: func(s core.Server) string { return s.Name }},
+		{name: "env", header: "ENVIRONMENT", value: func(s core.Server) string { return s.Env }},
+		{name: "type", header: "TYPE", value: func(s core.Server) string { return s.Type }},
+		{name: "region", header: "REGION", value: func(s core.Server) string { return s.Region }},
+		{name: "private-ip", header: "PRIVATE IP", value: func(s core.Server) string { return s.PrivateIP }},
+		{name: "public-ip", header: "PUBLIC IP", value: func(s core.Server) string { return s.PublicIP }},
+		{name: "instance-id", header: "INSTANCE ID", value: attribute("instance-id")},
+		{name: "instance-type", header: "INSTANCE TYPE", value: attribute("instance-type")},
+		{name: "state", header: "STATE", value: attribute("state")},
+		{name: "launch-time", header: "LAUNCH TIME", value: attribute("launch-time")},
+		{name: "az", header: "AZ", value: attribute("az")},
+		{name: "vpc-id", header: "VPC ID", value: attribute("vpc-id")},
+		{name: "subnet-id", header: "SUBNET ID", value: attribute("subnet-id")},
+		{name: "image-id", header: "IMAGE ID", value: attribute("image-id")},
+		{name: "key-name", header: "KEY NAME", value: attribute("key-name")},
+		{name: "platform", header: "PLATFORM", value: attribute("platform")},
+	}
+
+	// defaultColumns stores the columns printed in table and csv outputs if
+	// none are selected.
+	defaultColumns = []string{"name", "env", "private-ip", "public-ip"}
+
+	// wideColumns stores the columns printed in wide output if none are
+	// selected.
+	wideColumns = []string{"name", "env", "type", "region", "private-ip", "public-ip", "instance-id", "instance-type", "state", "az", "vpc-id"}
+)
+
+// attribute returns a function getting the server attribute value.
+func attribute(name string) func(core.Server) string {
+	return func(s core.Server) string {
+		return s.Attribute(name)
+	}
+}
+
+// columnNames returns the names of all the available columns.
+func columnNames() []string {
+	names := []string{}
+	for _, col := range columns {
+		names = append(names, col.name)
+	}
+	return names
+}
+
+// getColumns returns the column definitions of the selected columns.
+func getColumns(names []string) ([]column, error) {
+	selected := []column{}
+	for _, name := range names {
+		found := false
+		for _, col := range columns {
+			if col.name == strings.ToLower(name) {
+				selected = append(selected, col)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("invalid column: %s, any of: %s", name, strings.Join(columnNames(), ","))
+		}
+	}
+	return selected, nil
+}
+
+// sortServers sorts the servers by the selected columns. A column name
+// prefixed with `-` sorts in descending order.
+func sortServers(servers []core.Server, keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	type sortKey struct {
+		col  column
+		desc bool
+	}
+
+	sortKeys := []sortKey{}
+	for _, key := range keys {
+		desc := strings.HasPrefix(key, "-")
+		cols, err := getColumns([]string{strings.TrimPrefix(key, "-")})
+		if err != nil {
+			return err
+		}
+		sortKeys = append(sortKeys, sortKey{col: cols[0], desc: desc})
+	}
+
+	sort.SliceStable(servers, func(i, j int) bool {
+		for _, key := range sortKeys {
+			a, b := key.col.value(servers[i]), key.col.value(servers[j])
+			if a == b {
+				continue
+			}
+			if key.desc {
+				return a > b
+			}
+			return a < b
+		}
+		return false
+	})
+	return nil
+}
+
+// printServers prints the servers in the selected output format. Selected
+// columns apply to table, wide and csv outputs.
+func printServers(w io.Writer, servers []core.Server, output string, columnNames []string) error {
+	if strings.HasPrefix(output, outputGoTemplate) {
+		return printTemplate(w, servers, strings.TrimPrefix(output, outputGoTemplate))
+	}
+
+	if len(columnNames) == 0 {
+		columnNames = defaultColumns
+		if output == outputWide {
+			columnNames = wideColumns
+		}
+	}
+
+	cols, err := getColumns(columnNames)
+	if err != nil {
+		return err
+	}
+
+	switch output {
+	case outputTable, outputWide:
+		return printTable(w, servers, cols)
+	case outputJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(servers)
+	case outputYAML:
+		return yaml.NewEncoder(w).Encode(servers)
+	case outputCSV:
+		return printCSV(w, servers, cols)
+	case outputName:
+		for _, server := range servers {
+			fmt.Fprintln(w, server.Name)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("invalid output format: %s, any of: table,wide,json,yaml,csv,name,go-template=...", output)
+}
+
+// printTable prints the servers as a table.
+func printTable(w io.Writer, servers []core.Server, cols []column) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+
+	headers := make([]string, len(cols))
+	for i, col := range cols {
+		headers[i] = col.header
+	}
+	fmt.Fprintln(tw, strings.Join(headers, "\t"))
+
+	for _, server := range servers {
+		fmt.Fprintln(tw, strings.Join(columnValues(server, cols), "\t"))
+	}
+	return tw.Flush()
+}
+
+// printCSV prints the servers as csv with a header row.
+func printCSV(w io.Writer, servers []core.Server, cols []column) error {
+	cw := csv.NewWriter(w)
+
+	headers := make([]string, len(cols))
+	for i, col := range cols {
+		headers[i] = col.name
+	}
+	if err := cw.Write(headers); err != nil {
+		return err
+	}
+
+	for _, server := range servers {
+		if err := cw.Write(columnValues(server, cols)); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// printTemplate executes the go template for every server, each on a new
+// line.
+func printTemplate(w io.Writer, servers []core.Server, text string) error {
+	tmpl, err := template.New("output").Parse(text)
+	if err != nil {
+		return fmt.Errorf("invalid go-template: %v", err)
+	}
+
+	for _, server := range servers {
+		if err = tmpl.Execute(w, server); err != nil {
+			return fmt.Errorf("error executing go-template: %v", err)
+		}
+		fmt.Fprintln(w)
+	}
+	return nil
+}
+
+// columnValues returns the server values of the selected columns.
+func columnValues(server core.Server, cols []column) []string {
+	values := make([]string, len(cols))
+	for i, col := range cols {
+		values[i] = col.value(server)
+	}
+	return values
+}
@@ -0,0 +1,130 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/gr00by87/fst/config"
+	"github.com/gr00by87/fst/core"
+	survey "gopkg.in/AlecAivazis/survey.v1"
+	surveyCore "gopkg.in/AlecAivazis/survey.v1/core"
+)
+
+// pickerPageSize is the number of servers displayed at once by the picker.
+const pickerPageSize = 15
+
+// resolveServer finds the server identified by id. If no server is found, the
+// servers with names containing id are looked up. If id is empty or matches
+// more than one server, an interactive picker is displayed.
+func resolveServer(ctx context.Context, cfg *config.Config, provider core.Provider, regions []string, id string) (*core.Server, error) {
+	if id == "" {
+		servers, err := provider.ListServers(ctx, regions)
+		checkDiscoveryError(err)
+		return pickServer(servers, "Select server:")
+	}
+
+	privateNetworks, err := cfg.PrivateNetworks()
+	if err != nil {
+		return nil, err
+	}
+
+	sid := core.NewServerID(id, privateNetworks...)
+	servers, err := provider.FindServers(ctx, regions, sid)
+	if err != nil {
+		return nil, err
+	}
+
+	// Names can look like instance ids, so they're looked up as names too.
+	if len(servers) == 0 && (sid.Type == core.IDTypeName || sid.Type == core.IDTypeInstanceID) {
+		servers, err = provider.ListServers(ctx, regions, core.NewFilter(core.TagName, []string{id}, core.Contains, true))
+		checkDiscoveryError(err)
+	}
+
+	switch len(servers) {
+	case 0:
+		return nil, fmt.Errorf("server not found: %s", id)
+	case 1:
+		return &servers[0], nil
+	}
+
+	return pickServer(servers, fmt.Sprintf("%d servers match %s, select one:", len(servers), id))
+}
+
+// pickServer displays an interactive picker with fuzzy search over the
+// servers. The picker is rendered to stderr, so it doesn't mix with the
+// command output.
+func pickServer(servers []core.Server, msg string) (*core.Server, error) {
+	if len(servers) == 0 {
+		return nil, fmt.Errorf("no servers found")
+	}
+
+	options := pickerOptions(servers)
+
+	surveyCore.QuestionIcon = "?"
+	answer := ""
+	if err := survey.AskOne(&survey.Select{
+		Message:  msg,
+		Options:  options,
+		PageSize: pickerPageSize,
+		FilterFn: fuzzyFilter,
+	}, &answer, nil, survey.WithStdio(os.Stdin, os.Stderr, os.Stderr)); err != nil {
+		return nil, err
+	}
+
+	for i, option := range options {
+		if option == answer {
+			return &servers[i], nil
+		}
+	}
+	return nil, fmt.Errorf("invalid selection: %s", answer)
+}
+
+// pickerOptions returns the picker rows of the servers, in the same order. The
+// rows include the instance ids and identical rows are numbered, so every row
+// selects a single server.
+func pickerOptions(servers []core.Server) []string {
+	buf := &bytes.Buffer{}
+	w := tabwriter.NewWriter(buf, 0, 0, 3, ' ', 0)
+	for _, server := range servers {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", server.Name, server.Env, server.Region, server.PrivateIP, server.InstanceID)
+	}
+	w.Flush()
+
+	options := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	seen := make(map[string]int, len(options))
+	for i := range options {
+		options[i] = strings.TrimRight(options[i], " ")
+		seen[options[i]]++
+		if n := seen[options[i]]; n > 1 {
+			options[i] = fmt.Sprintf("%s (%d)", options[i], n)
+		}
+	}
+	return options
+}
+
+// fuzzyFilter returns the options containing all the characters of the
+// filter in the same order, ignoring case and spaces.
+func fuzzyFilter(filter string, options []string) []string {
+	filter = strings.ToLower(strings.Replace(filter, " ", "", -1))
+
+	filtered := []string{}
+	for _, option := range options {
+		remaining := filter
+		for _, r := range strings.ToLower(option) {
+			if remaining == "" {
+				break
+			}
+			if strings.HasPrefix(remaining, string(r)) {
+				remaining = remaining[len(string(r)):]
+			}
+		}
+		if remaining == "" {
+			filtered = append(filtered, option)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,27 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gr00by87/fst/core"
+)
+
+func TestPickerOptions(t *testing.T) {
+	servers := []core.Server{
+		{Name: "api-1", Env: "prod", Region: "us-east-1", PrivateIP: "10.0.0.1", InstanceID: "i-01234567"},
+		{Name: "api-1", Env: "prod", Region: "us-east-1", PrivateIP: "10.0.0.1", InstanceID: "i-89abcdef"},
+		{Name: "worker", Env: "prod", Region: "us-east-1", PrivateIP: "10.0.0.2"},
+		{Name: "worker", Env: "prod", Region: "us-east-1", PrivateIP: "10.0.0.2"},
+	}
+
+	want := []string{
+		"api-1    prod   us-east-1   10.0.0.1   i-01234567",
+		"api-1    prod   us-east-1   10.0.0.1   i-89abcdef",
+		"worker   prod   us-east-1   10.0.0.2",
+		"worker   prod   us-east-1   10.0.0.2 (2)",
+	}
+	if got := pickerOptions(servers); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("pickerOptions() =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
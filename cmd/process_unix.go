@@ -0,0 +1,20 @@
+//go:build !windows
+// +build !windows
+
+package cmd
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// execProcess replaces the current process with the command described by
+// argv. It only returns if the command cannot be executed.
+func execProcess(argv []string) error {
+	path, err := exec.LookPath(argv[0])
+	if err != nil {
+		return err
+	}
+	return syscall.Exec(path, argv, os.Environ())
+}
@@ -0,0 +1,29 @@
+//go:build windows
+// +build windows
+
+package cmd
+
+import (
+	"os"
+	"os/exec"
+)
+
+// execProcess runs the command described by argv attached to the standard
+// streams and exits with its exit code. It only returns if the command cannot
+// be executed.
+func execProcess(argv []string) error {
+	cmd := exec.Command(argv[0], argv[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			os.Exit(exitErr.ExitCode())
+		}
+		return err
+	}
+
+	os.Exit(0)
+	return nil
+}
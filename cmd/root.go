@@ -4,12 +4,28 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/gr00by87/fst/config"
 	"github.com/spf13/cobra"
 )
 
-// rootCmd represents the base command when called without any subcommands.
-var rootCmd = &cobra.Command{
-	Use: "fst",
+var (
+	contextName *string
+	configFile  *string
+
+	// rootCmd represents the base command when called without any subcommands.
+	rootCmd = &cobra.Command{
+		Use: "fst",
+		PersistentPreRun: func(_ *cobra.Command, _ []string) {
+			config.SetContext(*contextName)
+			config.SetFile(*configFile)
+		},
+	}
+)
+
+// init initializes the cobra command and flags.
+func init() {
+	contextName = rootCmd.PersistentFlags().String("context", "", "config context to use instead of the current one")
+	configFile = rootCmd.PersistentFlags().String("config", "", "config file location, json, yaml or toml by the extension (default $FST_CONFIG, $XDG_CONFIG_HOME/fst/config.json or ~/.fst.cfg)")
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
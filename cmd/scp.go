@@ -2,8 +2,6 @@ package cmd
 
 import (
 	"errors"
-	"fmt"
-	"os"
 	"regexp"
 	"strings"
 
@@ -14,6 +12,8 @@ import (
 var (
 	scpConfigFile   *string
 	scpIdentityFile *string
+	scpRefresh      *bool
+	scpPrint        *bool
 
 	// instanceRe is used to extract the instance identifier from command args.
 	instanceRe = regexp.MustCompile(`^(?:.*@|)(.*)\:.*`)
@@ -23,7 +23,7 @@ var (
 		Use:   "scp",
 		Args:  cobra.MinimumNArgs(2),
 		Short: "Copy file to, from, or between instances",
-		Long:  "This subcommand allows files to be copied to, from, or between instances. It accepts either server's public ip address, private ip address or it's name as instance identifier.",
+		Long:  "This subcommand allows files to be copied to, from, or between instances. It accepts either server's public ip address, private ip address, instance id or it's name as instance identifier.",
 		Run:   runSCP,
 	}
 )
@@ -33,37 +33,57 @@ func init() {
 	rootCmd.AddCommand(scpCmd)
 	scpConfigFile = scpCmd.Flags().StringP("config-file", "F", "", "configuration file location")
 	scpIdentityFile = scpCmd.Flags().StringP("identity-file", "i", "", "identity file location")
+	scpRefresh = scpCmd.Flags().Bool("refresh", false, "bypass the server inventory cache")
+	scpPrint = scpCmd.Flags().Bool("print", false, "print the scp command instead of executing it")
 }
 
 // runSCP executes the scp command.
 func runSCP(_ *cobra.Command, args []string) {
 	cfg := checkBastionHosts()
 
-	region := ""
+	provider := newProvider(cfg, *scpRefresh)
+	ctx, cancel := discoveryContext()
+	defer cancel()
+
+	regions, err := configuredRegions(ctx, cfg, provider)
+	if err != nil {
+		exitWithError(err)
+	}
+
+	var target *core.Server
 	for i, arg := range args {
 		if matches := instanceRe.FindStringSubmatch(arg); len(matches) == 2 {
-			server, err := core.GetSingleServer(cfg.AWSCredentials, core.NewServerID(matches[1]))
+			server, err := resolveServer(ctx, cfg, provider, regions, matches[1])
 			if err != nil {
 				exitWithError(err)
 			}
 
-			if region != "" && server.Region != region {
+			if target != nil && server.Region != target.Region {
 				exitWithError(errors.New("servers are not within the same aws region"))
 			}
 
-			region = server.Region
+			// The servers are reached through the same bastion host.
+			if target != nil && server.VPCID != target.VPCID {
+				exitWithError(errors.New("servers are not within the same vpc"))
+			}
+
+			target = server
 			args[i] = strings.Replace(arg, matches[1], server.PrivateIP, 1)
 		}
 	}
 
-	bastionHosts := cfg.BastionHosts[region]
-	if len(bastionHosts) == 0 && !disableBastionHostCheck[region] {
-		exitWithError(fmt.Errorf("bastion host not found for region: %s", region))
+	if target == nil {
+		exitWithError(errors.New("no remote instance passed"))
+	}
+
+	bastion, err := jumpHost(ctx, cfg, provider, *target)
+	if err != nil {
+		exitWithError(err)
 	}
 
 	cmd := []string{"scp"}
-	if len(bastionHosts) > 0 {
-		cmd = append(cmd, fmt.Sprintf("-o 'ProxyJump %s'", randomHost(bastionHosts)))
+	if bastion != "" {
+		cmd = append(cmd, "-o", "ProxyJump "+bastion)
 	}
 	if *scpConfigFile != "" {
 		cmd = append(cmd, "-F", *scpConfigFile)
@@ -73,6 +93,5 @@ func runSCP(_ *cobra.Command, args []string) {
 	}
 	cmd = append(cmd, args...)
 
-	fmt.Println(strings.Join(cmd, " "))
-	os.Exit(3)
+	execCommand(cmd, *scpPrint)
 }
@@ -1,98 +1,569 @@
 package cmd
 
 import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"net"
 	"os"
 	"os/user"
-	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/alecthomas/template"
+	"github.com/gr00by87/fst/config"
+	"github.com/gr00by87/fst/core"
 	"github.com/gr00by87/fst/templates"
 	"github.com/spf13/cobra"
 )
 
+const (
+	// managedBlockBegin and managedBlockEnd delimit the part of the ssh config
+	// file managed by fst.
+	managedBlockBegin = "# BEGIN fst"
+	managedBlockEnd   = "# END fst"
+
+	// includeFileName is the name of the ssh config file written in include
+	// mode.
+	includeFileName = "fst.config"
+)
+
 var (
 	proxyJumpRegion *string
+	proxyJumpVPC    *string
+	sshConfigInc    *bool
+	sshConfigDiff   *bool
+	sshConfigDryRun *bool
+	sshConfigHosts  *bool
+	sshConfigTmpl   *string
+	sshConfigOutput *string
+	sshConfigFilter filterFlags
 
 	// templateName stores the template name.
 	templateName = "ssh-config"
 
-	// configTemplate stores the ssh config template.
-	configTemplate = template.Must(template.New(templateName).Parse(templates.SSHConfig))
-
 	// sshConfigCmd represents the ssh-config command.
 	sshConfigCmd = &cobra.Command{
 		Use:   "ssh-config",
 		Short: "Create ssh config file",
-		Long:  "This subcommand generates a ssh config file containing all the bastion hosts and ProxyJump configuration for selected region.",
+		Long:  "This subcommand generates ssh config containing all the bastion hosts and ProxyJump configuration for selected region, optionally with an entry for every server. A custom template can be used instead of the built-in one, it's executed with the data described in the templates package (SSHConfigData) and can use lower, replace and default helper functions. Only the block delimited by `# BEGIN fst` and `# END fst` lines in ~/.ssh/config is updated, the rest of the file is kept intact. In include mode the config is written to ~/.ssh/fst.config instead, and included from ~/.ssh/config. A backup of every changed file is taken before writing.",
 		Run:   runSSHConfig,
 	}
 )
 
-// templateData stores the ssh config template data.
-type templateData struct {
-	JumpHost     string
-	BastionHosts []bastionHost
-}
-
-// bastionHost stores a single bastion host data.
-type bastionHost struct {
-	Region string
-	IP     string
-	ID     int
-}
-
 // init initializes the cobra command and flags.
 func init() {
 	rootCmd.AddCommand(sshConfigCmd)
-	proxyJumpRegion = sshConfigCmd.Flags().StringP("region", "r", "us-east-1", "region to use in ProxyJump configuration, one of: us-east-1,us-west-2,eu-west-1,ap-northeast-1,ap-southeast-2")
+	proxyJumpRegion = sshConfigCmd.Flags().StringP("region", "r", "", "region to use in ProxyJump configuration, any of the configured regions with bastion hosts, defaults to the first one")
+	proxyJumpVPC = sshConfigCmd.Flags().String("vpc", "", "vpc to use in ProxyJump configuration, the first bastion host assigned to the vpc is used instead of the region one")
+	sshConfigInc = sshConfigCmd.Flags().Bool("include", false, "write the config to ~/.ssh/fst.config and include it from ~/.ssh/config")
+	sshConfigDiff = sshConfigCmd.Flags().Bool("diff", false, "print the changes instead of applying them")
+	sshConfigDryRun = sshConfigCmd.Flags().Bool("dry-run", false, "print the updated files instead of writing them")
+	sshConfigHosts = sshConfigCmd.Flags().Bool("servers", false, "add a Host entry for every server from all the configured regions, named after the server, limited by the filter flags")
+	sshConfigTmpl = sshConfigCmd.Flags().String("template", "", "custom ssh config template file location, overrides the one set in the config file")
+	sshConfigOutput = sshConfigCmd.Flags().StringP("output", "o", "", "write the config to the file instead of the ssh config, or print it if - is passed")
+	addTagFilterFlags(sshConfigCmd, &sshConfigFilter)
+	sshConfigFilter.region = &[]string{"all"}
 }
 
 // runSSHConfig executes the ssh-config command.
 func runSSHConfig(_ *cobra.Command, _ []string) {
 	cfg := checkBastionHosts()
 
-	if _, ok := cfg.BastionHosts[*proxyJumpRegion]; !ok {
-		exitWithError(fmt.Errorf("invalid region: %s", *proxyJumpRegion))
+	ctx, cancel := discoveryContext()
+	defer cancel()
+
+	provider := newProvider(cfg, false)
+	regions, err := configuredRegions(ctx, cfg, provider)
+	if err != nil {
+		exitWithError(err)
+	}
+
+	privateNetworks, err := cfg.PrivateNetworks()
+	if err != nil {
+		exitWithError(err)
 	}
 
-	if !proceed("This will overwrite your current ssh config file, do you want to proceed?") {
-		return
+	bastionRegions := []string{}
+	for _, region := range regions {
+		if len(cfg.BastionHosts[region]) > 0 {
+			bastionRegions = append(bastionRegions, region)
+		}
 	}
 
-	bastionHosts := []bastionHost{}
-	for region, hosts := range cfg.BastionHosts {
-		for id, ip := range hosts {
-			bastionHosts = append(bastionHosts, bastionHost{
-				Region: region,
-				IP:     ip,
-				ID:     id + 1,
+	jumpRegions, err := checkRegions(stringToSlice(*proxyJumpRegion), bastionRegions)
+	if err != nil {
+		exitWithError(err)
+	}
+
+	jumpHost := bastionAlias(jumpRegions[0], 0)
+	if *proxyJumpVPC != "" {
+		if *proxyJumpRegion != "" {
+			exitWithError(errors.New("--region and --vpc flags can't be used together"))
+		}
+		if jumpHost, err = vpcJumpHost(cfg, *proxyJumpVPC); err != nil {
+			exitWithError(err)
+		}
+	}
+
+	regionNames := []string{}
+	for region := range cfg.BastionHosts {
+		regionNames = append(regionNames, region)
+	}
+	sort.Strings(regionNames)
+
+	bastionHosts := []templates.BastionHost{}
+	aliases := map[string]string{}
+	for _, region := range regionNames {
+		for id, host := range cfg.BastionHosts[region] {
+			alias := bastionAlias(region, id)
+			if _, ok := aliases[host.IP]; !ok {
+				aliases[host.IP] = alias
+			}
+			bastionHosts = append(bastionHosts, templates.BastionHost{
+				Region:     region,
+				Name:       host.Name,
+				InstanceID: host.InstanceID,
+				IP:         host.IP,
+				VPCID:      host.VPCID,
+				ID:         id + 1,
+				Alias:      alias,
 			})
 		}
 	}
 
-	sshConfigFile, err := openConfigFile()
+	servers := []templates.ServerHost{}
+	if *sshConfigHosts {
+		servers = serverHosts(cfg, filterServers(cfg, sshConfigFilter), aliases)
+	}
+
+	privateHosts := []string{}
+	for _, network := range append(core.PrivateNetworks(), privateNetworks...) {
+		privateHosts = append(privateHosts, cidrPatterns(network)...)
+	}
+
+	tmpl, err := sshConfigTemplate(cfg)
 	if err != nil {
-		exitWithError(fmt.Errorf("error opening ssh config: %v", err))
+		exitWithError(err)
 	}
-	defer sshConfigFile.Close()
 
-	if err = configTemplate.ExecuteTemplate(sshConfigFile, templateName, templateData{
-		JumpHost:     fmt.Sprintf("%s-01", *proxyJumpRegion),
+	buf := &bytes.Buffer{}
+	if err = tmpl.ExecuteTemplate(buf, templateName, templates.SSHConfigData{
+		JumpHost:     jumpHost,
+		PrivateHosts: strings.Join(privateHosts, " "),
+		ProxyJumps:   vpcProxyJumps(ctx, cfg, provider, regions, aliases),
 		BastionHosts: bastionHosts,
+		Servers:      servers,
+		Regions:      regions,
+		User:         cfg.SSH.User,
+		IdentityFile: cfg.SSH.IdentityFile,
 	}); err != nil {
-		exitWithError(fmt.Errorf("error saving ssh config: %v", err))
+		exitWithError(fmt.Errorf("error generating ssh config: %v", err))
+	}
+	generated := strings.TrimRight(buf.String(), "\n") + "\n"
+
+	var changes []fileChange
+	switch *sshConfigOutput {
+	case "":
+		changes, err = sshConfigChanges(generated, *sshConfigInc)
+	case "-":
+		fmt.Print(generated)
+		return
+	default:
+		changes, err = outputChanges(*sshConfigOutput, generated)
+	}
+	if err != nil {
+		exitWithError(fmt.Errorf("error reading ssh config: %v", err))
+	}
+
+	if len(changes) == 0 {
+		fmt.Println(success, "SSH config is up to date")
+		return
+	}
+
+	for _, change := range changes {
+		switch {
+		case *sshConfigDiff:
+			fmt.Print(unifiedDiff(change.path, change.old, change.new))
+		case *sshConfigDryRun:
+			fmt.Println(info, change.path)
+			fmt.Print(change.new)
+		default:
+			if err = change.apply(); err != nil {
+				exitWithError(fmt.Errorf("error saving ssh config: %v", err))
+			}
+		}
+	}
+
+	if !*sshConfigDiff && !*sshConfigDryRun {
+		fmt.Println(success, "SSH config updated successfully")
+	}
+}
+
+// vpcJumpHost returns the ssh config name of the first bastion host assigned
+// to the vpc.
+func vpcJumpHost(cfg *config.Config, vpc string) (string, error) {
+	regions := []string{}
+	for region := range cfg.BastionHosts {
+		regions = append(regions, region)
+	}
+	sort.Strings(regions)
+
+	for _, region := range regions {
+		for id, host := range cfg.BastionHosts[region] {
+			if host.VPCID == vpc {
+				return bastionAlias(region, id), nil
+			}
+		}
+	}
+	return "", fmt.Errorf("bastion host not found for vpc: %s", vpc)
+}
+
+// sshConfigTemplate parses the ssh config template. The template passed with
+// the flag takes precedence over the one set in the config file, the built-in
+// one is used if neither is set.
+func sshConfigTemplate(cfg *config.Config) (*template.Template, error) {
+	content, file := templates.SSHConfig, *sshConfigTmpl
+	if file == "" {
+		file = cfg.SSH.Template
+	}
+
+	if file != "" {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("error reading ssh config template: %v", err)
+		}
+		content = string(data)
+	}
+
+	tmpl, err := template.New(templateName).Funcs(templates.Funcs).Parse(content)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing ssh config template: %v", err)
+	}
+	return tmpl, nil
+}
+
+// vpcProxyJumps returns the ProxyJump configuration of the CIDR blocks of
+// all the VPCs in the regions, routed to the bastion hosts of the VPC, see
+// jumpHost. VPCs without bastion hosts are skipped. If the VPCs can't be
+// discovered, a warning is printed and no configuration is returned.
+func vpcProxyJumps(ctx context.Context, cfg *config.Config, provider core.Provider, regions []string, aliases map[string]string) []templates.ProxyJump {
+	discoverer, ok := provider.(core.NetworkDiscoverer)
+	if !ok {
+		return nil
+	}
+
+	networks, err := discoverer.DiscoverNetworks(ctx, regions)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, warning, "Skipping VPC ProxyJump configuration:", err)
+		return nil
+	}
+
+	proxyJumps := []templates.ProxyJump{}
+	seen := map[string]string{}
+	for _, network := range networks {
+		addresses := cfg.BastionAddresses(network.Region, network.VPCID)
+		if len(addresses) == 0 {
+			continue
+		}
+
+		for _, cidr := range network.CIDRs {
+			_, ipNet, err := net.ParseCIDR(cidr)
+			if err != nil {
+				continue
+			}
+
+			// ssh uses the first matching ProxyJump, so overlapping blocks
+			// can't be routed to different bastion hosts.
+			if vpc, ok := seen[ipNet.String()]; ok {
+				fmt.Fprintf(os.Stderr, "%s Skipping CIDR %s of %s, it's already routed to %s\n", warning, cidr, network.VPCID, vpc)
+				continue
+			}
+			seen[ipNet.String()] = network.VPCID
+
+			proxyJumps = append(proxyJumps, templates.ProxyJump{
+				Region:   network.Region,
+				VPCID:    network.VPCID,
+				CIDR:     cidr,
+				Hosts:    strings.Join(cidrPatterns(ipNet), " "),
+				JumpHost: aliases[addresses[0]],
+			})
+		}
+	}
+	return proxyJumps
+}
+
+// cidrPatterns converts the network into ssh config host patterns, as ssh
+// matches hosts with wildcards only. Networks not aligned to an octet are
+// expanded into all their subnetworks aligned to the next octet, e.g.
+// 100.64.0.0/10 into 100.64.* to 100.127.*. IPv6 networks are not supported.
+func cidrPatterns(network *net.IPNet) []string {
+	ip := network.IP.To4()
+	if ip == nil {
+		return nil
+	}
+
+	ones, _ := network.Mask.Size()
+	octets := (ones + 7) / 8
+	base := binary.BigEndian.Uint32(ip)
+
+	patterns := []string{}
+	for i := 0; i < 1<<uint(octets*8-ones); i++ {
+		addr := base + uint32(i)<<uint(32-octets*8)
+
+		parts := []string{}
+		for octet := 0; octet < octets; octet++ {
+			parts = append(parts, strconv.Itoa(int(addr>>uint(24-8*octet)&0xff)))
+		}
+		if octets < 4 {
+			parts = append(parts, "*")
+		}
+		patterns = append(patterns, strings.Join(parts, "."))
+	}
+	return patterns
+}
+
+// bastionAlias returns the ssh config name of the region bastion host.
+func bastionAlias(region string, id int) string {
+	return fmt.Sprintf("%s-0%d", region, id+1)
+}
+
+// serverHosts returns the ssh config entries of the servers. Servers without
+// a unique name are named after the instance id. The entries jump through the
+// bastion hosts routing to the server VPC, see jumpHost.
+func serverHosts(cfg *config.Config, servers []core.Server, aliases map[string]string) []templates.ServerHost {
+	names := map[string]int{}
+	for _, server := range servers {
+		names[server.Name]++
+	}
+
+	hosts := []templates.ServerHost{}
+	for _, server := range servers {
+		host := strings.Join(strings.Fields(server.Name), "-")
+		if host == "" || names[server.Name] > 1 {
+			host = strings.TrimPrefix(host+"-"+server.InstanceID, "-")
+		}
+
+		jumpHost := ""
+		if addresses := cfg.BastionAddresses(server.Region, server.VPCID); len(addresses) > 0 {
+			jumpHost = aliases[addresses[0]]
+		}
+
+		hosts = append(hosts, templates.ServerHost{
+			Host:         host,
+			Name:         server.Name,
+			InstanceID:   server.InstanceID,
+			Region:       server.Region,
+			Env:          server.Env,
+			Type:         server.Type,
+			VPCID:        server.VPCID,
+			IP:           server.PrivateIP,
+			PublicIP:     server.PublicIP,
+			Tags:         server.Tags,
+			JumpHost:     jumpHost,
+			User:         cfg.SSH.User,
+			IdentityFile: cfg.SSH.IdentityFile,
+		})
 	}
+	return hosts
+}
 
-	fmt.Println(success, "SSH config updated successfully")
+// fileChange stores the current and the updated content of a file.
+type fileChange struct {
+	path   string
+	old    string
+	new    string
+	exists bool
 }
 
-// openConfigFile opens ssh config file for writing.
-func openConfigFile() (*os.File, error) {
+// apply takes a timestamped backup of the file, if it exists, and writes the
+// updated content.
+func (c fileChange) apply() error {
+	if err := os.MkdirAll(filepath.Dir(c.path), 0700); err != nil {
+		return err
+	}
+
+	if c.exists {
+		backup := fmt.Sprintf("%s.fst-backup-%s", c.path, time.Now().Format("20060102150405"))
+		if err := ioutil.WriteFile(backup, []byte(c.old), 0600); err != nil {
+			return err
+		}
+	}
+
+	return ioutil.WriteFile(c.path, []byte(c.new), 0600)
+}
+
+// sshConfigChanges returns the changes to the ssh config files needed to
+// store the generated config. Files that are already up to date are omitted.
+func sshConfigChanges(generated string, includeMode bool) ([]fileChange, error) {
 	usr, err := user.Current()
 	if err != nil {
 		return nil, err
 	}
+	sshDir := filepath.Join(usr.HomeDir, ".ssh")
+
+	sshConfig, err := readFileChange(filepath.Join(sshDir, "config"))
+	if err != nil {
+		return nil, err
+	}
 
-	return os.OpenFile(path.Join(usr.HomeDir, ".ssh/config"), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	include := "Include " + includeFileName
+	changes := []fileChange{}
+	if includeMode {
+		included, err := readFileChange(filepath.Join(sshDir, includeFileName))
+		if err != nil {
+			return nil, err
+		}
+		included.new = generated
+		changes = append(changes, included)
+
+		// Remove the block written in the default mode, it would take
+		// precedence over the included config.
+		if sshConfig.new, err = replaceManagedBlock(sshConfig.old, ""); err != nil {
+			return nil, err
+		}
+		sshConfig.new = addInclude(sshConfig.new, include)
+	} else {
+		sshConfig.new = removeInclude(sshConfig.old, include)
+		if sshConfig.new, err = replaceManagedBlock(sshConfig.new, generated); err != nil {
+			return nil, err
+		}
+	}
+	changes = append(changes, sshConfig)
+
+	updated := []fileChange{}
+	for _, change := range changes {
+		if change.old != change.new {
+			updated = append(updated, change)
+		}
+	}
+	return updated, nil
+}
+
+// outputChanges returns the change of the output file needed to store the
+// generated config, or none if it's already up to date.
+func outputChanges(path, generated string) ([]fileChange, error) {
+	if *sshConfigInc {
+		return nil, errors.New("--include and --output flags can't be used together")
+	}
+
+	change, err := readFileChange(path)
+	if err != nil {
+		return nil, err
+	}
+
+	change.new = generated
+	if change.old == change.new {
+		return nil, nil
+	}
+	return []fileChange{change}, nil
+}
+
+// readFileChange reads the current content of the file. A missing file is
+// treated as empty.
+func readFileChange(path string) (fileChange, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return fileChange{path: path}, nil
+	}
+	if err != nil {
+		return fileChange{}, err
+	}
+	return fileChange{path: path, old: string(data), new: string(data), exists: true}, nil
+}
+
+// replaceManagedBlock replaces the content of the managed block with the
+// generated config. The block is appended if the content doesn't have one. If
+// generated is empty, the block is removed.
+func replaceManagedBlock(content, generated string) (string, error) {
+	block := ""
+	if generated != "" {
+		block = managedBlockBegin + "\n" + generated + managedBlockEnd + "\n"
+	}
+
+	lines := strings.SplitAfter(content, "\n")
+	begin, end := -1, -1
+	for i, line := range lines {
+		switch strings.TrimSpace(line) {
+		case managedBlockBegin:
+			if begin < 0 {
+				begin = i
+			}
+		case managedBlockEnd:
+			if begin >= 0 && end < 0 {
+				end = i
+			}
+		}
+	}
+
+	if begin < 0 {
+		if block == "" {
+			return content, nil
+		}
+		if content != "" && !strings.HasSuffix(content, "\n") {
+			content += "\n"
+		}
+		if content != "" && !strings.HasSuffix(content, "\n\n") {
+			content += "\n"
+		}
+		return content + block, nil
+	}
+
+	if end < 0 {
+		return "", fmt.Errorf("missing %q line after %q", managedBlockEnd, managedBlockBegin)
+	}
+
+	before, after := strings.Join(lines[:begin], ""), strings.Join(lines[end+1:], "")
+	if block == "" && after == "" && strings.HasSuffix(before, "\n\n") {
+		// Drop the blank line separating the removed block.
+		before = strings.TrimSuffix(before, "\n")
+	}
+	return before + block + after, nil
+}
+
+// addInclude adds the include line at the top of the content, as ssh applies
+// Include directives placed after a Host line only to that host.
+func addInclude(content, include string) string {
+	for _, line := range strings.Split(content, "\n") {
+		if strings.TrimSpace(line) == include {
+			return content
+		}
+	}
+
+	if content == "" {
+		return include + "\n"
+	}
+	return include + "\n\n" + content
+}
+
+// removeInclude removes the include line added by addInclude.
+func removeInclude(content, include string) string {
+	prefix := include + "\n\n"
+	if strings.HasPrefix(content, prefix) {
+		return strings.TrimPrefix(content, prefix)
+	}
+
+	lines := strings.SplitAfter(content, "\n")
+	kept := lines[:0]
+	for _, line := range lines {
+		if strings.TrimSpace(line) != include {
+			kept = append(kept, line)
+		}
+	}
+	return strings.Join(kept, "")
+}
+
+// stringToSlice returns a single element slice or an empty one if the string
+// is empty.
+func stringToSlice(str string) []string {
+	if str == "" {
+		return []string{}
+	}
+	return []string{str}
 }
@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestCIDRPatterns(t *testing.T) {
+	tests := []struct {
+		cidr string
+		want string
+	}{
+		{cidr: "10.0.0.0/8", want: "10.*"},
+		{cidr: "172.16.0.0/12", want: "172.16.* 172.17.* 172.18.* 172.19.* 172.20.* 172.21.* 172.22.* 172.23.* 172.24.* 172.25.* 172.26.* 172.27.* 172.28.* 172.29.* 172.30.* 172.31.*"},
+		{cidr: "192.168.0.0/16", want: "192.168.*"},
+		{cidr: "10.1.2.0/23", want: "10.1.2.* 10.1.3.*"},
+		{cidr: "10.1.2.0/24", want: "10.1.2.*"},
+		{cidr: "10.1.2.4/30", want: "10.1.2.4 10.1.2.5 10.1.2.6 10.1.2.7"},
+		{cidr: "10.1.2.3/32", want: "10.1.2.3"},
+		{cidr: "0.0.0.0/0", want: "*"},
+		{cidr: "fd00::/8", want: ""},
+	}
+
+	for _, tt := range tests {
+		_, network, err := net.ParseCIDR(tt.cidr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := strings.Join(cidrPatterns(network), " "); got != tt.want {
+			t.Errorf("cidrPatterns(%s) = %q, want %q", tt.cidr, got, tt.want)
+		}
+	}
+}
+
+func TestReplaceManagedBlock(t *testing.T) {
+	const generated = "Host bastion\n  User ec2-user\n"
+	const block = managedBlockBegin + "\n" + generated + managedBlockEnd + "\n"
+
+	tests := []struct {
+		name      string
+		content   string
+		generated string
+		want      string
+		wantErr   bool
+	}{
+		{
+			name:      "empty file",
+			generated: generated,
+			want:      block,
+		},
+		{
+			name:      "appended after a blank line",
+			content:   "Host *\n  ServerAliveInterval 60",
+			generated: generated,
+			want:      "Host *\n  ServerAliveInterval 60\n\n" + block,
+		},
+		{
+			name:      "existing blank line kept",
+			content:   "Host *\n\n",
+			generated: generated,
+			want:      "Host *\n\n" + block,
+		},
+		{
+			name:      "block replaced in place",
+			content:   "Host a\n\n" + managedBlockBegin + "\nHost old\n" + managedBlockEnd + "\n\nHost b\n",
+			generated: generated,
+			want:      "Host a\n\n" + block + "\nHost b\n",
+		},
+		{
+			name:      "indented markers",
+			content:   "  " + managedBlockBegin + "\nHost old\n  " + managedBlockEnd + "\n",
+			generated: generated,
+			want:      block,
+		},
+		{
+			name:    "block removed with its blank line",
+			content: "Host a\n\n" + block,
+			want:    "Host a\n",
+		},
+		{
+			name:    "block removed between hosts",
+			content: "Host a\n\n" + block + "\nHost b\n",
+			want:    "Host a\n\n\nHost b\n",
+		},
+		{
+			name:    "nothing to remove",
+			content: "Host a\n",
+			want:    "Host a\n",
+		},
+		{
+			name:      "missing end marker",
+			content:   managedBlockBegin + "\nHost old\n",
+			generated: generated,
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		got, err := replaceManagedBlock(tt.content, tt.generated)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected error", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: replaceManagedBlock() error: %v", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: replaceManagedBlock() =\n%q\nwant\n%q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -1,11 +1,10 @@
 package cmd
 
 import (
-	"fmt"
+	"errors"
 	"os"
-	"strings"
 
-	"github.com/gr00by87/fst/core"
+	"github.com/gr00by87/fst/sshclient"
 	"github.com/spf13/cobra"
 )
 
@@ -15,13 +14,17 @@ var (
 	sshConfigFile                *string
 	sshIdentityFile              *string
 	sshDoNotExecuteRemoteCommand *bool
+	sshRefresh                   *bool
+	sshPrint                     *bool
+	sshForwardAgent              *bool
+	sshNative                    *bool
 
 	// sshCmd represents the ssh command.
 	sshCmd = &cobra.Command{
-		Use:   "ssh",
-		Args:  cobra.ExactArgs(1),
+		Use:   "ssh [instance]",
+		Args:  cobra.MaximumNArgs(1),
 		Short: "Connect via ssh to an instance",
-		Long:  "This subcommand connects via ssh to an instance. It accepts exactly 1 argument - an instance identifier, which can be either server's public ip address, private ip address or it's name",
+		Long:  "This subcommand connects via ssh to an instance. It accepts 1 argument - an instance identifier, which can be either server's public ip address, private ip address, instance id or it's name (or a part of it). If the argument is omitted or matches more than one server, an interactive server picker is displayed.",
 		Run:   runSSH,
 	}
 )
@@ -34,25 +37,51 @@ func init() {
 	sshConfigFile = sshCmd.Flags().StringP("config-file", "F", "", "configuration file location")
 	sshIdentityFile = sshCmd.Flags().StringP("identity-file", "i", "", "identity file location")
 	sshDoNotExecuteRemoteCommand = sshCmd.Flags().BoolP("do-not-execute", "N", false, "do not execute a remote command (this is useful for just forwarding ports)")
+	sshRefresh = sshCmd.Flags().Bool("refresh", false, "bypass the server inventory cache")
+	sshPrint = sshCmd.Flags().Bool("print", false, "print the ssh command instead of executing it")
+	sshForwardAgent = sshCmd.Flags().BoolP("forward-agent", "A", false, "enable ssh agent forwarding")
+	sshNative = sshCmd.Flags().Bool("native", false, "use the built-in ssh client instead of the system ssh command (port forwarding and ssh config files are not supported)")
 }
 
 // runSSH executes the ssh command.
 func runSSH(_ *cobra.Command, args []string) {
 	cfg := checkBastionHosts()
 
-	server, err := core.GetSingleServer(cfg.AWSCredentials, core.NewServerID(args[0]))
+	ctx, cancel := discoveryContext()
+	defer cancel()
+
+	provider := newProvider(cfg, *sshRefresh)
+	regions, err := configuredRegions(ctx, cfg, provider)
+	if err != nil {
+		exitWithError(err)
+	}
+
+	id := ""
+	if len(args) > 0 {
+		id = args[0]
+	}
+
+	server, err := resolveServer(ctx, cfg, provider, regions, id)
+	if err != nil {
+		exitWithError(err)
+	}
+
+	bastion, err := jumpHost(ctx, cfg, provider, *server)
 	if err != nil {
 		exitWithError(err)
 	}
 
-	bastionHosts := cfg.BastionHosts[server.Region]
-	if len(bastionHosts) == 0 && !disableBastionHostCheck[server.Region] {
-		exitWithError(fmt.Errorf("bastion host not found for region: %s", server.Region))
+	if *sshNative {
+		runNativeSSH(bastion, server.PrivateIP)
+		return
 	}
 
 	cmd := []string{"ssh"}
-	if len(bastionHosts) > 0 {
-		cmd = append(cmd, "-J", randomHost(bastionHosts))
+	if bastion != "" {
+		cmd = append(cmd, "-J", bastion)
+	}
+	if *sshForwardAgent {
+		cmd = append(cmd, "-A")
 	}
 	if *forwardPort != "" {
 		cmd = append(cmd, "-L", *forwardPort)
@@ -71,6 +100,29 @@ func runSSH(_ *cobra.Command, args []string) {
 		cmd = append(cmd, "-N")
 	}
 
-	fmt.Println(strings.Join(cmd, " "))
-	os.Exit(3)
+	execCommand(cmd, *sshPrint)
+}
+
+// runNativeSSH connects to the host using the built-in ssh client and exits
+// with the remote shell exit status.
+func runNativeSSH(bastion, host string) {
+	if *forwardPort != "" || *sshConfigFile != "" || *sshDoNotExecuteRemoteCommand || *sshPrint {
+		exitWithError(errors.New("--forward-port, --config-file, --do-not-execute and --print flags are not supported by the built-in ssh client"))
+	}
+
+	client, err := sshclient.Dial(sshclient.Config{
+		User:         *loginName,
+		IdentityFile: *sshIdentityFile,
+		ForwardAgent: *sshForwardAgent,
+	}, bastion, host)
+	if err != nil {
+		exitWithError(err)
+	}
+
+	status, err := client.Shell()
+	client.Close()
+	if err != nil {
+		exitWithError(err)
+	}
+	os.Exit(status)
 }
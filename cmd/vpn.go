@@ -83,14 +83,19 @@ func connect(cfg *config.Config, pritunl *vpn.Pritunl) {
 		},
 	}
 
-	if cfg.VPNConfig.OTPSecret == "" {
+	otpSecret, err := cfg.VPNConfig.GetOTPSecret()
+	if err != nil {
+		exitWithError(err)
+	}
+
+	if otpSecret == "" {
 		prompts = append(prompts, &survey.Question{
 			Name:     "OTP",
 			Prompt:   &survey.Input{Message: "Enter OTP Code:"},
 			Validate: validateLength("OTP Code", 6),
 		})
 	} else {
-		credentials.OTP = gotp.NewDefaultTOTP(cfg.VPNConfig.OTPSecret).Now()
+		credentials.OTP = gotp.NewDefaultTOTP(otpSecret).Now()
 	}
 
 	if err := survey.Ask(prompts, &credentials); err != nil {
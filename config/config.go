@@ -3,12 +3,53 @@ package config
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
 	"os"
-	"os/user"
-	"path"
+	"path/filepath"
+	"sort"
 )
 
-const fileName = ".fst.cfg"
+const (
+	// fileName is the name of the config file created by older versions in
+	// the home directory.
+	fileName = ".fst.cfg"
+	// filePermMode is the mode of the config file, it's readable by the owner
+	// only, as it may contain secrets stored by older versions.
+	filePermMode = 0600
+
+	// DefaultContext is the name of the context used if none is selected.
+	DefaultContext = "default"
+)
+
+// AWS credential sources.
+const (
+	// CredentialSourceDefault uses the default AWS SDK credential chain:
+	// environment variables, shared config and credentials files (including
+	// SSO cached credentials) and instance roles.
+	CredentialSourceDefault = "default"
+	// CredentialSourceStatic uses the ID and Secret stored in the config file.
+	CredentialSourceStatic = "static"
+	// CredentialSourceProfile uses a named profile from the shared config
+	// and credentials files.
+	CredentialSourceProfile = "profile"
+	// CredentialSourceEnv uses the AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY
+	// environment variables.
+	CredentialSourceEnv = "env"
+	// CredentialSourceAssumeRole assumes a role using the credentials of the
+	// Profile, or the default credential chain if Profile is not set.
+	CredentialSourceAssumeRole = "assume-role"
+)
+
+// CredentialSources stores the list of supported AWS credential sources.
+var CredentialSources = []string{
+	CredentialSourceDefault,
+	CredentialSourceStatic,
+	CredentialSourceProfile,
+	CredentialSourceEnv,
+	CredentialSourceAssumeRole,
+}
 
 var (
 	errConfigLoad = errors.New("failed to load config file, use `fst config` to run configuration setup")
@@ -17,59 +58,551 @@ var (
 
 // Config stores config file structure.
 type Config struct {
-	AWSCredentials AWSCredentials      `json:"aws_credentials"`
-	BastionHosts   map[string][]string `json:"bastion_hosts"`
-	VPNConfig      VPNConfig           `json:"vpn_config"`
+	AWSCredentials AWSCredentials           `json:"aws_credentials"`
+	BastionHosts   map[string][]BastionHost `json:"bastion_hosts"`
+	VPNConfig      VPNConfig                `json:"vpn_config"`
+	Cache          CacheConfig              `json:"cache"`
+	Bastion        BastionConfig            `json:"bastion"`
+	SSH            SSHConfig                `json:"ssh"`
+	// Regions stores the regions the commands operate on and their settings.
+	// DefaultRegions are used if it's empty.
+	Regions []RegionConfig `json:"regions,omitempty"`
+	// AutoDiscoverRegions enables the discovery of all the regions enabled in
+	// the AWS account. Regions settings still apply to the discovered ones.
+	// It's unset unless it's configured, see GetAutoDiscoverRegions.
+	AutoDiscoverRegions *bool `json:"auto_discover_regions,omitempty"`
+	// PrivateCIDRs stores the networks treated as private, besides the RFC
+	// 1918 ones, e.g. 100.64.0.0/10.
+	PrivateCIDRs []string `json:"private_cidrs,omitempty"`
+
+	// SecretStore stores the kind of the secret store holding the AWS secret
+	// and the OTP secret, see the secrets package. The secrets are kept in the
+	// config file by older versions if it's empty.
+	SecretStore string `json:"secret_store,omitempty"`
+
+	// Context stores the name of the context the config was loaded from.
+	Context string `json:"-"`
+
+	// secretsLoaded is set if the secrets were read from the secret store.
+	secretsLoaded bool
+	// secrets reads the secrets deferred by LoadFromFile.
+	secrets *secretLoader
+	// envOverrides stores the values overridden by environment variables, by
+	// the config key.
+	envOverrides map[string]envOverride
 }
 
 // AWSCredentials stores the AWS credentials.
 type AWSCredentials struct {
-	ID     string `json:"id"`
-	Secret string `json:"secret"`
+	Source     string `json:"source,omitempty"`
+	ID         string `json:"id,omitempty"`
+	Secret     string `json:"secret,omitempty"`
+	Profile    string `json:"profile,omitempty"`
+	RoleARN    string `json:"role_arn,omitempty"`
+	ExternalID string `json:"external_id,omitempty"`
+	MFASerial  string `json:"mfa_serial,omitempty"`
+
+	// secrets reads the Secret deferred by LoadFromFile.
+	secrets *secretLoader
+}
+
+// GetSource returns the credential source. Configs created before the source
+// was introduced only store static credentials.
+func (c AWSCredentials) GetSource() string {
+	if c.Source == "" {
+		return CredentialSourceStatic
+	}
+	return c.Source
+}
+
+// IsConfigured reports whether all the values required by the credential
+// source are set.
+func (c AWSCredentials) IsConfigured() bool {
+	switch c.GetSource() {
+	case CredentialSourceStatic:
+		secret, err := c.GetSecret()
+		return c.ID != "" && secret != "" && err == nil
+	case CredentialSourceProfile:
+		return c.Profile != ""
+	case CredentialSourceAssumeRole:
+		return c.RoleARN != ""
+	case CredentialSourceDefault, CredentialSourceEnv:
+		return true
+	}
+	return false
+}
+
+// GetSecret returns the static credentials secret, read from the secret
+// store on first use.
+func (c AWSCredentials) GetSecret() (string, error) {
+	if c.Secret != "" || c.secrets == nil {
+		return c.Secret, nil
+	}
+	if err := c.secrets.load(); err != nil {
+		return "", err
+	}
+	return c.secrets.cfg.AWSCredentials.Secret, nil
 }
 
 // VPNConfig stores the VPN configuration.
 type VPNConfig struct {
-	ProfileID string `json:"profile_id"`
-	OTPSecret string `json:"otp_secret"`
+	ProfileID string `json:"profile_id,omitempty"`
+	OTPSecret string `json:"otp_secret,omitempty"`
+
+	// secrets reads the OTPSecret deferred by LoadFromFile.
+	secrets *secretLoader
+}
+
+// GetOTPSecret returns the OTP secret, read from the secret store on first
+// use.
+func (c VPNConfig) GetOTPSecret() (string, error) {
+	if c.OTPSecret != "" || c.secrets == nil {
+		return c.OTPSecret, nil
+	}
+	if err := c.secrets.load(); err != nil {
+		return "", err
+	}
+	return c.secrets.cfg.VPNConfig.OTPSecret, nil
+}
+
+// RegionConfig stores the region specific configuration.
+type RegionConfig struct {
+	Name string `json:"name"`
+	// NoBastion disables the bastion host requirement for servers reachable
+	// directly, e.g. over VPN.
+	NoBastion bool `json:"no_bastion,omitempty"`
+}
+
+// DefaultRegions stores the regions used if none are configured.
+var DefaultRegions = []RegionConfig{
+	{Name: "us-east-1", NoBastion: true},
+	{Name: "us-west-2"},
+	{Name: "eu-west-1"},
+	{Name: "ap-northeast-1"},
+	{Name: "ap-southeast-2"},
+}
+
+// GetAutoDiscoverRegions reports whether the region auto-discovery is
+// enabled.
+func (c *Config) GetAutoDiscoverRegions() bool {
+	return c.AutoDiscoverRegions != nil && *c.AutoDiscoverRegions
+}
+
+// GetRegions returns the configured regions, or DefaultRegions if none are
+// configured.
+func (c *Config) GetRegions() []RegionConfig {
+	if len(c.Regions) == 0 {
+		return DefaultRegions
+	}
+	return c.Regions
+}
+
+// RegionNames returns the names of the configured regions.
+func (c *Config) RegionNames() []string {
+	names := []string{}
+	for _, region := range c.GetRegions() {
+		names = append(names, region.Name)
+	}
+	return names
+}
+
+// GetRegion returns the region configuration. Regions that aren't configured
+// use the default settings.
+func (c *Config) GetRegion(name string) RegionConfig {
+	for _, region := range c.GetRegions() {
+		if region.Name == name {
+			return region
+		}
+	}
+	return RegionConfig{Name: name}
+}
+
+// SSHConfig stores the settings of the generated ssh config.
+type SSHConfig struct {
+	User         string `json:"user,omitempty"`
+	IdentityFile string `json:"identity_file,omitempty"`
+	// Template is the location of the custom ssh config template, the
+	// built-in one is used if it's not set.
+	Template string `json:"template,omitempty"`
+}
+
+// PrivateNetworks parses the private CIDRs.
+func (c *Config) PrivateNetworks() ([]*net.IPNet, error) {
+	networks := []*net.IPNet{}
+	for _, cidr := range c.PrivateCIDRs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid private cidr: %s", cidr)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// CacheConfig stores the server inventory cache configuration.
+type CacheConfig struct {
+	// Disabled is unset unless it's configured, so false disables the cache
+	// enabled in the system-wide config file, see IsDisabled.
+	Disabled *bool `json:"disabled,omitempty"`
+	// TTL is the cache time to live in seconds, the default one is used if
+	// it's not set.
+	TTL int `json:"ttl,omitempty"`
+}
+
+// IsDisabled reports whether the cache is disabled.
+func (c CacheConfig) IsDisabled() bool {
+	return c.Disabled != nil && *c.Disabled
+}
+
+// BastionConfig stores the bastion host selection configuration.
+type BastionConfig struct {
+	// ProbeTimeout is the bastion host health probe timeout in milliseconds,
+	// the default one is used if it's not set.
+	ProbeTimeout int `json:"probe_timeout,omitempty"`
+	// Cooldown is the time in seconds a failed bastion host is skipped for,
+	// the default one is used if it's not set.
+	Cooldown int `json:"cooldown,omitempty"`
+	// TagKey and TagValue select the servers discovered as bastion hosts,
+	// the default ones are used if they're not set.
+	TagKey   string `json:"tag_key,omitempty"`
+	TagValue string `json:"tag_value,omitempty"`
+	// Static stores the bastion host addresses per region. Bastion hosts of
+	// the listed regions are not discovered.
+	Static map[string][]string `json:"static,omitempty"`
+	// VPCs maps VPC IDs to the identifiers (instance ID, ip address or name)
+	// of the servers used as bastion hosts for that VPC.
+	VPCs map[string][]string `json:"vpcs,omitempty"`
+}
+
+// Default bastion host discovery tag.
+const (
+	DefaultBastionTagKey   = "Type"
+	DefaultBastionTagValue = "bastion"
+)
+
+// GetTag returns the bastion host discovery tag key and value.
+func (c BastionConfig) GetTag() (string, string) {
+	key, value := c.TagKey, c.TagValue
+	if key == "" {
+		key = DefaultBastionTagKey
+	}
+	if value == "" {
+		value = DefaultBastionTagValue
+	}
+	return key, value
+}
+
+// BastionHost stores the bastion host details. Name and InstanceID are empty
+// for static bastion hosts.
+type BastionHost struct {
+	Name       string `json:"name,omitempty"`
+	InstanceID string `json:"instance_id,omitempty"`
+	IP         string `json:"ip"`
+	VPCID      string `json:"vpc_id,omitempty"`
+}
+
+// BastionAddresses returns the unique ip addresses of the bastion hosts used
+// to reach servers in the VPC of the region. The bastion hosts of the VPC are
+// looked up in all the regions, as VPCs can be peered across regions. If
+// there are none, the region bastion hosts not assigned to any VPC (static
+// ones or stored by older versions) are returned, or all the region bastion
+// hosts if there are none of them either, as VPCs without bastion hosts are
+// usually peered with the ones that have them. If vpc is empty, all the region
+// bastion hosts are returned.
+func (c *Config) BastionAddresses(region, vpc string) []string {
+	hosts := c.BastionHosts[region]
+	if vpc != "" {
+		if vpcHosts := c.vpcBastionHosts(vpc); len(vpcHosts) > 0 {
+			hosts = vpcHosts
+		} else if unassigned := c.vpcBastionHosts("", region); len(unassigned) > 0 {
+			hosts = unassigned
+		}
+	}
+
+	addresses, seen := []string{}, map[string]bool{}
+	for _, host := range hosts {
+		if !seen[host.IP] {
+			seen[host.IP] = true
+			addresses = append(addresses, host.IP)
+		}
+	}
+	return addresses
+}
+
+// vpcBastionHosts returns the bastion hosts assigned to the VPC in the
+// regions, or in all the regions if none are passed.
+func (c *Config) vpcBastionHosts(vpc string, regions ...string) []BastionHost {
+	if len(regions) == 0 {
+		for region := range c.BastionHosts {
+			regions = append(regions, region)
+		}
+		sort.Strings(regions)
+	}
+
+	hosts := []BastionHost{}
+	for _, region := range regions {
+		for _, host := range c.BastionHosts[region] {
+			if host.VPCID == vpc {
+				hosts = append(hosts, host)
+			}
+		}
+	}
+	return hosts
+}
+
+// File stores the config file structure. Each context holds a complete,
+// independent configuration, e.g. one per AWS account.
+type File struct {
+	// Version is the version of the config file structure, see migrations.
+	Version        int                `json:"version"`
+	CurrentContext string             `json:"current_context,omitempty"`
+	Contexts       map[string]*Config `json:"contexts"`
+
+	// layer stores the values set in the file as generic values, merged
+	// with the other config file layers, see mergeLayer.
+	layer map[string]interface{}
+}
+
+// contextOverride stores the context selected with SetContext.
+var contextOverride string
+
+// SetContext overrides the current context of the config file in
+// LoadFromFile and SaveToFile calls.
+func SetContext(name string) {
+	contextOverride = name
+}
+
+// SelectedContext returns the name of the context used by LoadFromFile and
+// SaveToFile.
+func (f *File) SelectedContext() string {
+	switch {
+	case contextOverride != "":
+		return contextOverride
+	case f.CurrentContext != "":
+		return f.CurrentContext
+	default:
+		return DefaultContext
+	}
 }
 
-// SaveToFile saves configuration data to file.
+// SaveToFile saves configuration data to the selected context of the config
+// file.
 func SaveToFile(cfg *Config) error {
-	usr, err := user.Current()
+	f, err := LoadFile()
+	if err == errConfigLoad {
+		f = &File{}
+	} else if err != nil {
+		return err
+	}
+
+	name := f.SelectedContext()
+	if f.Contexts == nil {
+		f.Contexts = make(map[string]*Config)
+	}
+	if f.CurrentContext == "" {
+		f.CurrentContext = name
+	}
+	if f.Contexts[name], err = cfg.withoutEnv(); err != nil {
+		return err
+	}
+
+	return SaveFile(f)
+}
+
+// contextNotFoundError is returned by LoadFromFile if the selected context
+// doesn't exist.
+type contextNotFoundError string
+
+// Error implements the error interface.
+func (e contextNotFoundError) Error() string {
+	return fmt.Sprintf("context not found: %s, use `fst context list` to list available contexts", string(e))
+}
+
+// IsNotExist reports whether the error is returned because the config file,
+// or the selected context, doesn't exist yet. Other errors, e.g. an invalid
+// config file, mean the existing configuration must not be overwritten.
+func IsNotExist(err error) bool {
+	_, ok := err.(contextNotFoundError)
+	return ok || err == errConfigLoad
+}
+
+// LoadFromFile loads configuration data from the selected context of the
+// config file. The values are overridden by the FST_* environment variables,
+// see EnvName. The secrets are read from the secret store when they're first
+// used, see ReadSecrets.
+func LoadFromFile() (*Config, error) {
+	f, err := LoadFile()
+	if err != nil {
+		return nil, err
+	}
+
+	name := f.SelectedContext()
+	cfg, ok := f.Contexts[name]
+	if !ok {
+		return nil, contextNotFoundError(name)
+	}
+	cfg.Context = name
+
+	// Move the secrets stored in the config file by older versions to the
+	// secret store. The config still works if it fails, it's retried on the
+	// next load.
+	migrated := true
+	if f.hasPlainSecrets() {
+		migrated = SaveFile(f) == nil
+	}
+
+	if err = cfg.applyEnv(); err != nil {
+		return nil, err
+	}
+
+	if migrated {
+		cfg.deferSecrets()
+	}
+
+	return cfg, nil
+}
+
+// hasPlainSecrets reports whether any of the contexts has secrets stored in
+// the config file.
+func (f *File) hasPlainSecrets() bool {
+	for _, cfg := range f.Contexts {
+		if cfg.hasPlainSecrets() {
+			return true
+		}
+	}
+	return false
+}
+
+// SaveFile saves the user config file, in the format selected by its
+// extension. The secrets are moved to the secret store and the values equal
+// to the system-wide config file ones are not saved.
+func SaveFile(f *File) error {
+	filePath, err := FilePath()
+	if err != nil {
+		return err
+	}
+
+	stripped := &File{
+		Version:        CurrentVersion,
+		CurrentContext: f.CurrentContext,
+		Contexts:       make(map[string]*Config),
+	}
+	for name, cfg := range f.Contexts {
+		if err = storeSecrets(cfg, name); err != nil {
+			return err
+		}
+		stripped.Contexts[name] = cfg.withoutSecrets()
+	}
+
+	data, err := json.MarshalIndent(stripped, "", "  ")
+	if err != nil {
+		return errConfigSave
+	}
+
+	system, err := loadSystemLayer()
 	if err != nil {
 		return err
 	}
+	if system != nil {
+		usr, err := genericFile(stripped)
+		if err != nil {
+			return errConfigSave
+		}
+		if data, err = json.MarshalIndent(subtractLayer(usr, system), "", "  "); err != nil {
+			return errConfigSave
+		}
+	}
+
+	if data, err = fromJSON(append(data, '\n'), fileFormat(filePath)); err != nil {
+		return fmt.Errorf("error encoding config file: %v", err)
+	}
 
-	file, err := os.OpenFile(path.Join(usr.HomeDir, fileName), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err = os.MkdirAll(filepath.Dir(filePath), 0700); err != nil {
+		return errConfigSave
+	}
+
+	file, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, filePermMode)
 	if err != nil {
 		return errConfigSave
 	}
 	defer file.Close()
 
-	if err = json.NewEncoder(file).Encode(cfg); err != nil {
+	// OpenFile doesn't change the mode of existing files.
+	if err = file.Chmod(filePermMode); err != nil {
+		return errConfigSave
+	}
+
+	if _, err = file.Write(data); err != nil {
 		return errConfigSave
 	}
 	return nil
 }
 
-// LoadFromFile loads configuration data from file.
-func LoadFromFile() (*Config, error) {
-	usr, err := user.Current()
+// LoadFile loads the user config file, merged into the system-wide one if
+// there's any, see SystemFilePath. User config files created by older
+// versions are migrated to the current version, the original file is backed
+// up.
+func LoadFile() (*File, error) {
+	filePath, err := FilePath()
 	if err != nil {
 		return nil, err
 	}
 
-	file, err := os.Open(path.Join(usr.HomeDir, fileName))
+	f, err := loadLayer(filePath, true)
+	if err != nil && err != errConfigLoad {
+		return nil, err
+	}
+
+	system, systemErr := loadSystemLayer()
+	if systemErr != nil {
+		return nil, systemErr
+	}
+	if system == nil {
+		return f, err
+	}
+
+	usr := map[string]interface{}{}
+	if f != nil && f.layer != nil {
+		usr = f.layer
+	}
+
+	data, err := json.Marshal(mergeLayer(system, usr))
 	if err != nil {
-		return nil, errConfigLoad
+		return nil, err
 	}
-	defer file.Close()
 
-	cfg := &Config{}
-	if err = json.NewDecoder(file).Decode(cfg); err != nil {
+	merged := &File{}
+	if err = json.Unmarshal(data, merged); err != nil {
+		return nil, fmt.Errorf("error merging config files: %v", err)
+	}
+	merged.Version = CurrentVersion
+	return merged, nil
+}
+
+// loadLayer loads the config file. If migrate is set, files created by older
+// versions are migrated on disk.
+func loadLayer(path string, migrate bool) (*File, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
 		return nil, errConfigLoad
 	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading config file: %v", err)
+	}
 
-	return cfg, nil
+	f, migrated, err := decodeFile(data, fileFormat(path), false)
+	if err != nil {
+		return nil, fmt.Errorf("error loading config file %s: %v", path, err)
+	}
+
+	if migrated != nil {
+		if migrate {
+			if err = writeMigrated(path, data, migrated, f.Version); err != nil {
+				return nil, err
+			}
+		}
+		f.Version = CurrentVersion
+	}
+
+	return f, nil
 }
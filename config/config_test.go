@@ -0,0 +1,49 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBastionAddresses(t *testing.T) {
+	cfg := &Config{
+		BastionHosts: map[string][]BastionHost{
+			"us-west-2": {
+				{InstanceID: "i-1", IP: "1.1.1.1", VPCID: "vpc-a"},
+				{InstanceID: "i-2", IP: "2.2.2.2", VPCID: "vpc-b"},
+				{InstanceID: "i-3", IP: "3.3.3.3", VPCID: "vpc-b"},
+			},
+			"eu-west-1": {
+				{IP: "4.4.4.4"},
+				{InstanceID: "i-5", IP: "5.5.5.5", VPCID: "vpc-c"},
+			},
+			"ap-northeast-1": {
+				{IP: "6.6.6.6"},
+				{IP: "6.6.6.6"},
+			},
+		},
+	}
+
+	tests := []struct {
+		name   string
+		region string
+		vpc    string
+		want   []string
+	}{
+		{name: "vpc bastion", region: "us-west-2", vpc: "vpc-a", want: []string{"1.1.1.1"}},
+		{name: "many vpc bastions", region: "us-west-2", vpc: "vpc-b", want: []string{"2.2.2.2", "3.3.3.3"}},
+		{name: "peered vpc in another region", region: "us-west-2", vpc: "vpc-c", want: []string{"5.5.5.5"}},
+		{name: "vpc without bastions falls back to region", region: "us-west-2", vpc: "vpc-x", want: []string{"1.1.1.1", "2.2.2.2", "3.3.3.3"}},
+		{name: "unassigned bastions preferred", region: "eu-west-1", vpc: "vpc-x", want: []string{"4.4.4.4"}},
+		{name: "no vpc", region: "us-west-2", want: []string{"1.1.1.1", "2.2.2.2", "3.3.3.3"}},
+		{name: "duplicates removed", region: "ap-northeast-1", vpc: "vpc-x", want: []string{"6.6.6.6"}},
+		{name: "region without bastions", region: "us-east-1", vpc: "vpc-a", want: []string{"1.1.1.1"}},
+		{name: "region and vpc without bastions", region: "us-east-1", vpc: "vpc-x", want: []string{}},
+	}
+
+	for _, tt := range tests {
+		if got := cfg.BastionAddresses(tt.region, tt.vpc); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: BastionAddresses(%q, %q) = %v, want %v", tt.name, tt.region, tt.vpc, got, tt.want)
+		}
+	}
+}
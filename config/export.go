@@ -0,0 +1,70 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// RedactedSecret replaces the secrets in the exported configs. Imported
+// secrets with this value keep the current ones.
+const RedactedSecret = "REDACTED"
+
+// Export returns the config as json, without the environment variable
+// overrides. The secrets are redacted unless withSecrets is set.
+func Export(cfg *Config, withSecrets bool) ([]byte, error) {
+	if err := cfg.ReadSecrets(); err != nil {
+		return nil, err
+	}
+
+	exported, err := cfg.withoutEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	if !withSecrets {
+		for _, value := range exported.secretFields() {
+			if *value != "" {
+				*value = RedactedSecret
+			}
+		}
+	}
+
+	data, err := json.MarshalIndent(exported, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// Import decodes the config exported with Export. Redacted secrets are taken
+// from the current config, if it's not nil. Secrets missing in the data are
+// removed from the secret store when the config is saved.
+func Import(data []byte, current *Config) (*Config, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+
+	cfg := &Config{}
+	if err := dec.Decode(cfg); err != nil {
+		return nil, decodeError(data, err, true)
+	}
+
+	currentSecrets := (&Config{}).secretFields()
+	if current != nil {
+		if err := current.ReadSecrets(); err != nil {
+			return nil, err
+		}
+		stored, err := current.withoutEnv()
+		if err != nil {
+			return nil, err
+		}
+		currentSecrets = stored.secretFields()
+	}
+	for name, value := range cfg.secretFields() {
+		if *value == RedactedSecret {
+			*value = *currentSecrets[name]
+		}
+	}
+	cfg.secretsLoaded = true
+
+	return cfg, nil
+}
@@ -0,0 +1,143 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Config file formats, selected by the file extension.
+const (
+	formatJSON = "json"
+	formatYAML = "yaml"
+	formatTOML = "toml"
+)
+
+// fileExtensions stores the config file extensions, in the order the files
+// are looked up.
+var fileExtensions = []string{".json", ".yaml", ".yml", ".toml"}
+
+// fileFormat returns the format of the config file. Files with unknown
+// extensions, e.g. ~/.fst.cfg, are json.
+func fileFormat(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return formatYAML
+	case ".toml":
+		return formatTOML
+	default:
+		return formatJSON
+	}
+}
+
+// toJSON converts the config file data from the format to json.
+func toJSON(data []byte, format string) ([]byte, error) {
+	var v interface{}
+	switch format {
+	case formatYAML:
+		if err := yaml.Unmarshal(data, &v); err != nil {
+			return nil, err
+		}
+		v = stringKeys(v)
+	case formatTOML:
+		m := map[string]interface{}{}
+		if _, err := toml.Decode(string(data), &m); err != nil {
+			return nil, err
+		}
+		v = m
+	default:
+		return data, nil
+	}
+
+	// Empty files store no values.
+	if v == nil {
+		v = map[string]interface{}{}
+	}
+	return json.Marshal(v)
+}
+
+// fromJSON converts the json data to the config file format.
+func fromJSON(data []byte, format string) ([]byte, error) {
+	if format == formatJSON {
+		return data, nil
+	}
+
+	v, err := decodeGeneric(data)
+	if err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case formatYAML:
+		return yaml.Marshal(v)
+	case formatTOML:
+		buf := bytes.Buffer{}
+		if err = toml.NewEncoder(&buf).Encode(v); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	return nil, fmt.Errorf("unsupported config file format: %s", format)
+}
+
+// decodeGeneric decodes the json data into maps, slices and scalars. Numbers
+// are decoded as int64, if possible, and null values are removed, as TOML
+// doesn't support them.
+func decodeGeneric(data []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return normalize(v), nil
+}
+
+// normalize converts the json numbers and removes the null values.
+func normalize(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if value == nil {
+				delete(v, key)
+				continue
+			}
+			v[key] = normalize(value)
+		}
+	case []interface{}:
+		for i, value := range v {
+			v[i] = normalize(value)
+		}
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	}
+	return v
+}
+
+// stringKeys converts the maps decoded from YAML to maps with string keys,
+// as required by json.
+func stringKeys(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := map[string]interface{}{}
+		for key, value := range v {
+			m[fmt.Sprint(key)] = stringKeys(value)
+		}
+		return m
+	case []interface{}:
+		for i, value := range v {
+			v[i] = stringKeys(value)
+		}
+	}
+	return v
+}
@@ -0,0 +1,319 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// EnvPrefix is the prefix of the environment variables overriding the config
+// values, e.g. FST_CACHE_TTL overrides the cache.ttl key.
+const EnvPrefix = "FST_"
+
+// Keys returns the config keys, the dot separated json field names, e.g.
+// aws_credentials.source. Map entries are addressed by appending the map key,
+// e.g. bastion.static.us-west-2.
+func Keys() []string {
+	keys := []string{}
+	collectKeys(reflect.TypeOf(Config{}), "", &keys)
+	sort.Strings(keys)
+	return keys
+}
+
+// collectKeys appends the keys of the struct fields to keys.
+func collectKeys(t reflect.Type, prefix string, keys *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		name := fieldName(t.Field(i))
+		if name == "" {
+			continue
+		}
+
+		if t.Field(i).Type.Kind() == reflect.Struct {
+			collectKeys(t.Field(i).Type, prefix+name+".", keys)
+			continue
+		}
+		*keys = append(*keys, prefix+name)
+	}
+}
+
+// fieldName returns the json name of the struct field, or an empty string if
+// it's not stored in the config file.
+func fieldName(field reflect.StructField) string {
+	if field.PkgPath != "" {
+		return ""
+	}
+
+	name := strings.Split(field.Tag.Get("json"), ",")[0]
+	if name == "-" {
+		return ""
+	}
+	return name
+}
+
+// Get returns the value of the config key. Lists are returned as comma
+// separated values, other non scalar values as json.
+func (c *Config) Get(key string) (string, error) {
+	if err := c.readSecretKey(key); err != nil {
+		return "", err
+	}
+
+	parts := strings.Split(key, ".")
+	v := reflect.ValueOf(c).Elem()
+	for i, part := range parts {
+		switch v.Kind() {
+		case reflect.Struct:
+			field, ok := structField(v, part)
+			if !ok {
+				return "", fmt.Errorf("unknown config key: %s", key)
+			}
+			v = field
+		case reflect.Map:
+			if i != len(parts)-1 {
+				return "", fmt.Errorf("unknown config key: %s", key)
+			}
+			v = v.MapIndex(reflect.ValueOf(part))
+			if !v.IsValid() {
+				return "", nil
+			}
+		default:
+			return "", fmt.Errorf("unknown config key: %s", key)
+		}
+	}
+	return formatValue(v)
+}
+
+// Set sets the value of the config key. Lists accept comma separated values
+// or a json array, other non scalar values accept json. Setting a map entry
+// to an empty value removes it.
+func (c *Config) Set(key, value string) error {
+	if err := c.readSecretKey(key); err != nil {
+		return err
+	}
+
+	parts := strings.Split(key, ".")
+	v := reflect.ValueOf(c).Elem()
+	for i, part := range parts {
+		switch v.Kind() {
+		case reflect.Struct:
+			field, ok := structField(v, part)
+			if !ok {
+				return fmt.Errorf("unknown config key: %s", key)
+			}
+			v = field
+		case reflect.Map:
+			if i != len(parts)-1 {
+				return fmt.Errorf("unknown config key: %s", key)
+			}
+			if value == "" {
+				v.SetMapIndex(reflect.ValueOf(part), reflect.Value{})
+				return nil
+			}
+
+			elem := reflect.New(v.Type().Elem()).Elem()
+			if err := parseValue(elem, value); err != nil {
+				return fmt.Errorf("invalid value for %s: %v", key, err)
+			}
+			if v.IsNil() {
+				v.Set(reflect.MakeMap(v.Type()))
+			}
+			v.SetMapIndex(reflect.ValueOf(part), elem)
+			return nil
+		default:
+			return fmt.Errorf("unknown config key: %s", key)
+		}
+	}
+
+	if err := parseValue(v, value); err != nil {
+		return fmt.Errorf("invalid value for %s: %v", key, err)
+	}
+	return nil
+}
+
+// structField returns the field of the struct with the json name.
+func structField(v reflect.Value, name string) (reflect.Value, bool) {
+	for i := 0; i < v.NumField(); i++ {
+		if fieldName(v.Type().Field(i)) == name {
+			return v.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// formatValue returns the string representation of the config value.
+func formatValue(v reflect.Value) (string, error) {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return "", nil
+		}
+		v = v.Elem()
+	}
+
+	if (v.Kind() == reflect.Map || v.Kind() == reflect.Slice) && v.Len() == 0 {
+		return "", nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Int:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.String {
+			return strings.Join(v.Interface().([]string), ","), nil
+		}
+	}
+
+	data, err := json.Marshal(v.Interface())
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// parseValue parses the string representation of the config value into v.
+func parseValue(v reflect.Value, value string) error {
+	switch v.Kind() {
+	case reflect.Ptr:
+		elem := reflect.New(v.Type().Elem())
+		if err := parseValue(elem.Elem(), value); err != nil {
+			return err
+		}
+		v.Set(elem)
+		return nil
+	case reflect.String:
+		v.SetString(value)
+		return nil
+	case reflect.Int:
+		i, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("expected a number, got %q", value)
+		}
+		v.SetInt(int64(i))
+		return nil
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("expected true or false, got %q", value)
+		}
+		v.SetBool(b)
+		return nil
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.String && !strings.HasPrefix(strings.TrimSpace(value), "[") {
+			v.Set(reflect.ValueOf(stringList(value)))
+			return nil
+		}
+	}
+
+	ptr := reflect.New(v.Type())
+	if err := json.Unmarshal([]byte(value), ptr.Interface()); err != nil {
+		return fmt.Errorf("expected json %s: %v", v.Type(), err)
+	}
+	v.Set(ptr.Elem())
+	return nil
+}
+
+// stringList splits the comma separated values, skipping the empty ones.
+func stringList(value string) []string {
+	list := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// EnvName returns the name of the environment variable overriding the config
+// key, e.g. FST_AWS_CREDENTIALS_SOURCE for aws_credentials.source.
+func EnvName(key string) string {
+	return EnvPrefix + strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(key))
+}
+
+// envOverride stores the value of a config key overridden by an environment
+// variable and the value it replaced.
+type envOverride struct {
+	stored reflect.Value
+	value  reflect.Value
+}
+
+// applyEnv overrides the config values with the FST_* environment variables.
+// The stored values are kept, so the overrides are not saved in the config
+// file.
+func (c *Config) applyEnv() error {
+	for _, key := range Keys() {
+		value, ok := os.LookupEnv(EnvName(key))
+		if !ok {
+			continue
+		}
+
+		field := c.field(key)
+		stored, err := copyValue(field)
+		if err != nil {
+			return err
+		}
+		if err = c.Set(key, value); err != nil {
+			return fmt.Errorf("invalid %s environment variable: %v", EnvName(key), err)
+		}
+
+		overridden, err := copyValue(field)
+		if err != nil {
+			return err
+		}
+
+		if c.envOverrides == nil {
+			c.envOverrides = map[string]envOverride{}
+		}
+		c.envOverrides[key] = envOverride{stored: stored, value: overridden}
+	}
+	return nil
+}
+
+// withoutEnv returns a copy of the config with the environment variable
+// overrides replaced by the stored values. The values changed since they
+// were loaded are kept.
+func (c *Config) withoutEnv() (*Config, error) {
+	stored := *c
+	stored.envOverrides = nil
+	for key, override := range c.envOverrides {
+		if !reflect.DeepEqual(c.field(key).Interface(), override.value.Interface()) {
+			continue
+		}
+
+		value, err := copyValue(override.stored)
+		if err != nil {
+			return nil, err
+		}
+		stored.field(key).Set(value)
+	}
+	return &stored, nil
+}
+
+// field returns the struct field of the config key, as returned by Keys.
+func (c *Config) field(key string) reflect.Value {
+	v := reflect.ValueOf(c).Elem()
+	for _, part := range strings.Split(key, ".") {
+		v, _ = structField(v, part)
+	}
+	return v
+}
+
+// copyValue returns a deep copy of the config value, so the maps and slices
+// aren't shared.
+func copyValue(v reflect.Value) (reflect.Value, error) {
+	data, err := json.Marshal(v.Interface())
+	if err != nil {
+		return reflect.Value{}, err
+	}
+
+	ptr := reflect.New(v.Type())
+	if err = json.Unmarshal(data, ptr.Interface()); err != nil {
+		return reflect.Value{}, err
+	}
+	return ptr.Elem(), nil
+}
@@ -0,0 +1,210 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// withConfigFile points the config file to a temporary one with the data and
+// returns its path and a cleanup function.
+func withConfigFile(t *testing.T, data string) (string, func()) {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "fst-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "config.json")
+	if err = ioutil.WriteFile(path, []byte(data), filePermMode); err != nil {
+		t.Fatal(err)
+	}
+
+	SetFile(path)
+	return path, func() {
+		SetFile("")
+		os.RemoveAll(dir)
+	}
+}
+
+func TestGetSet(t *testing.T) {
+	tests := []struct {
+		key   string
+		value string
+		want  string
+	}{
+		{key: "aws_credentials.source", value: "profile", want: "profile"},
+		{key: "cache.ttl", value: "60", want: "60"},
+		{key: "cache.disabled", value: "true", want: "true"},
+		{key: "private_cidrs", value: "100.64.0.0/10, 10.0.0.0/8", want: "100.64.0.0/10,10.0.0.0/8"},
+		{key: "private_cidrs", value: `["100.64.0.0/10"]`, want: "100.64.0.0/10"},
+		{key: "bastion.static.us-west-2", value: "1.1.1.1,2.2.2.2", want: "1.1.1.1,2.2.2.2"},
+		{key: "bastion.static", value: `{"eu-west-1":["3.3.3.3"]}`, want: `{"eu-west-1":["3.3.3.3"]}`},
+		{key: "regions", value: `[{"name":"us-east-1","no_bastion":true}]`, want: `[{"name":"us-east-1","no_bastion":true}]`},
+	}
+
+	for _, tt := range tests {
+		cfg := &Config{}
+		if err := cfg.Set(tt.key, tt.value); err != nil {
+			t.Errorf("Set(%q, %q) error: %v", tt.key, tt.value, err)
+			continue
+		}
+		if got, err := cfg.Get(tt.key); err != nil || got != tt.want {
+			t.Errorf("Get(%q) = %q, %v, want %q", tt.key, got, err, tt.want)
+		}
+	}
+}
+
+func TestSetErrors(t *testing.T) {
+	tests := []struct {
+		key   string
+		value string
+	}{
+		{key: "unknown", value: "1"},
+		{key: "cache.ttl.x", value: "1"},
+		{key: "cache.ttl", value: "abc"},
+		{key: "cache.disabled", value: "maybe"},
+		{key: "regions", value: "{"},
+	}
+
+	for _, tt := range tests {
+		if err := (&Config{}).Set(tt.key, tt.value); err == nil {
+			t.Errorf("Set(%q, %q) expected error", tt.key, tt.value)
+		}
+	}
+}
+
+func TestEnvOverridesNotSaved(t *testing.T) {
+	tests := []struct {
+		env    string
+		value  string
+		key    string
+		stored string
+	}{
+		{env: "FST_BASTION_STATIC", value: `{"us-west-2":["1.2.3.4"]}`, key: "bastion.static"},
+		{env: "FST_REGIONS", value: `[{"name":"eu-west-1"}]`, key: "regions"},
+		{env: "FST_PRIVATE_CIDRS", value: "100.64.0.0/10", key: "private_cidrs"},
+		{env: "FST_CACHE_TTL", value: "99", key: "cache.ttl", stored: "0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.env, func(t *testing.T) {
+			path, cleanup := withConfigFile(t, `{"version": 2, "current_context": "default", "contexts": {"default": {"ssh": {"user": "alice"}}}}`)
+			defer cleanup()
+
+			os.Setenv(tt.env, tt.value)
+			defer os.Unsetenv(tt.env)
+
+			cfg, err := LoadFromFile()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			overridden, _ := cfg.Get(tt.key)
+			if overridden == "" {
+				t.Fatalf("%s not overridden", tt.key)
+			}
+
+			if err = cfg.Set("ssh.user", "bob"); err != nil {
+				t.Fatal(err)
+			}
+			if err = SaveToFile(cfg); err != nil {
+				t.Fatalf("SaveToFile error: %v", err)
+			}
+
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			f, _, err := decodeFile(data, formatJSON, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			saved := f.Contexts[DefaultContext]
+			if got, _ := saved.Get(tt.key); got != tt.stored {
+				t.Errorf("%s saved as %q, want %q", tt.key, got, tt.stored)
+			}
+			if saved.SSH.User != "bob" {
+				t.Errorf("ssh.user saved as %q, want bob", saved.SSH.User)
+			}
+			if got, _ := cfg.Get(tt.key); got != overridden {
+				t.Errorf("%s = %q after save, want %q", tt.key, got, overridden)
+			}
+		})
+	}
+}
+
+func TestEnvOverrideChangedIsSaved(t *testing.T) {
+	_, cleanup := withConfigFile(t, `{"version": 2, "current_context": "default", "contexts": {"default": {"cache": {"ttl": 10}}}}`)
+	defer cleanup()
+
+	os.Setenv("FST_CACHE_TTL", "99")
+	defer os.Unsetenv("FST_CACHE_TTL")
+
+	cfg, err := LoadFromFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := cfg.withoutEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Cache.TTL != 10 {
+		t.Errorf("stored ttl = %d, want 10", stored.Cache.TTL)
+	}
+
+	cfg.Cache.TTL = 20
+	if stored, err = cfg.withoutEnv(); err != nil {
+		t.Fatal(err)
+	}
+	if stored.Cache.TTL != 20 {
+		t.Errorf("changed ttl = %d, want 20", stored.Cache.TTL)
+	}
+}
+
+func TestKeys(t *testing.T) {
+	keys := Keys()
+	for _, want := range []string{"aws_credentials.source", "bastion.static", "cache.ttl", "regions", "ssh.user"} {
+		found := false
+		for _, key := range keys {
+			found = found || key == want
+		}
+		if !found {
+			t.Errorf("Keys() missing %s", want)
+		}
+	}
+
+	if !reflect.DeepEqual(keys, Keys()) {
+		t.Error("Keys() not stable")
+	}
+}
+
+func TestIsNotExist(t *testing.T) {
+	_, cleanup := withConfigFile(t, `{"version": 2, "current_context": "default", "contexts": {"default": {}}}`)
+	defer cleanup()
+
+	SetContext("missing")
+	_, err := LoadFromFile()
+	SetContext("")
+	if !IsNotExist(err) {
+		t.Errorf("missing context: IsNotExist(%v) = false", err)
+	}
+
+	os.Setenv("FST_CACHE_TTL", "abc")
+	_, err = LoadFromFile()
+	os.Unsetenv("FST_CACHE_TTL")
+	if err == nil || IsNotExist(err) {
+		t.Errorf("invalid override: IsNotExist(%v) = true", err)
+	}
+
+	SetFile(filepath.Join(os.TempDir(), "fst-missing", "config.json"))
+	_, err = LoadFromFile()
+	if !IsNotExist(err) {
+		t.Errorf("missing file: IsNotExist(%v) = false", err)
+	}
+}
@@ -0,0 +1,179 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"os/user"
+	"path/filepath"
+	"reflect"
+	"runtime"
+)
+
+// FileEnv is the environment variable with the config file location.
+const FileEnv = "FST_CONFIG"
+
+// fileOverride stores the config file location set with SetFile.
+var fileOverride string
+
+// SetFile overrides the config file location.
+func SetFile(path string) {
+	fileOverride = path
+}
+
+// FilePath returns the location of the user config file. It's the one set
+// with SetFile or FST_CONFIG environment variable, the existing config file
+// in $XDG_CONFIG_HOME/fst or ~/.fst.cfg. New config files are created in
+// $XDG_CONFIG_HOME/fst/config.json.
+func FilePath() (string, error) {
+	if fileOverride != "" {
+		return fileOverride, nil
+	}
+	if path := os.Getenv(FileEnv); path != "" {
+		return path, nil
+	}
+
+	usr, err := user.Current()
+	if err != nil {
+		return "", err
+	}
+
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if configHome == "" {
+		configHome = filepath.Join(usr.HomeDir, ".config")
+	}
+	dir := filepath.Join(configHome, "fst")
+	if path := findFile(dir); path != "" {
+		return path, nil
+	}
+
+	legacy := filepath.Join(usr.HomeDir, fileName)
+	if _, err = os.Stat(legacy); err == nil {
+		return legacy, nil
+	}
+
+	return filepath.Join(dir, "config.json"), nil
+}
+
+// legacyFilePath returns the location of the config file created by older
+// versions, ~/.fst.cfg.
+func legacyFilePath() (string, error) {
+	usr, err := user.Current()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(usr.HomeDir, fileName), nil
+}
+
+// SystemFilePath returns the location of the system-wide config file, or an
+// empty string if there's none. It's config.json, config.yaml, config.yml or
+// config.toml in /etc/fst, or %ProgramData%\fst on Windows.
+func SystemFilePath() string {
+	dir := "/etc/fst"
+	if runtime.GOOS == "windows" {
+		dir = filepath.Join(os.Getenv("ProgramData"), "fst")
+	}
+	return findFile(dir)
+}
+
+// findFile returns the config file in the directory, with any of the
+// supported extensions, or an empty string if there's none.
+func findFile(dir string) string {
+	for _, ext := range fileExtensions {
+		path := filepath.Join(dir, "config"+ext)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// loadSystemLayer loads the system-wide config file as generic values, nil
+// is returned if there's none.
+func loadSystemLayer() (map[string]interface{}, error) {
+	path := SystemFilePath()
+	if path == "" {
+		return nil, nil
+	}
+
+	f, err := loadLayer(path, false)
+	if err != nil {
+		return nil, err
+	}
+	if f.layer == nil {
+		return map[string]interface{}{}, nil
+	}
+	return f.layer, nil
+}
+
+// genericFile returns the config file structure as generic values.
+func genericFile(f *File) (map[string]interface{}, error) {
+	data, err := json.Marshal(f)
+	if err != nil {
+		return nil, err
+	}
+
+	v, err := decodeGeneric(data)
+	if err != nil {
+		return nil, err
+	}
+	return v.(map[string]interface{}), nil
+}
+
+// mergeLayer merges the user config file values into the system-wide ones.
+// Maps are merged recursively, other values set in the user config file
+// replace the system-wide ones, even the empty ones, e.g. false.
+func mergeLayer(system, usr map[string]interface{}) map[string]interface{} {
+	for key, value := range usr {
+		userMap, isMap := value.(map[string]interface{})
+		if systemMap, ok := system[key].(map[string]interface{}); isMap && ok {
+			system[key] = mergeLayer(systemMap, userMap)
+			continue
+		}
+		system[key] = value
+	}
+	return system
+}
+
+// subtractLayer removes the user config file values equal to the
+// system-wide ones, so only the user changes are saved. The version is
+// always kept.
+func subtractLayer(usr, system map[string]interface{}) map[string]interface{} {
+	for key, value := range usr {
+		if key == "version" || system[key] == nil {
+			continue
+		}
+
+		userMap, isMap := value.(map[string]interface{})
+		systemMap, ok := system[key].(map[string]interface{})
+		switch {
+		case isMap && ok:
+			if usr[key] = subtractLayer(userMap, systemMap); len(userMap) == 0 {
+				delete(usr, key)
+			}
+		case reflect.DeepEqual(value, system[key]):
+			delete(usr, key)
+		}
+	}
+	return usr
+}
+
+// isZero reports whether the generic value is empty.
+func isZero(v interface{}) bool {
+	switch v := v.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case bool:
+		return !v
+	case int64:
+		return v == 0
+	case float64:
+		return v == 0
+	case []interface{}:
+		return len(v) == 0
+	case map[string]interface{}:
+		return len(v) == 0
+	}
+	return false
+}
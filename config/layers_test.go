@@ -0,0 +1,180 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// genericJSON decodes the json data into generic values, the way the config
+// file layers are decoded.
+func genericJSON(t *testing.T, data string) map[string]interface{} {
+	t.Helper()
+
+	v, err := decodeGeneric([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v.(map[string]interface{})
+}
+
+func TestMergeLayer(t *testing.T) {
+	tests := []struct {
+		name   string
+		system string
+		usr    string
+		want   string
+	}{
+		{
+			name:   "user values added",
+			system: `{"cache": {"ttl": 60}}`,
+			usr:    `{"ssh": {"user": "alice"}}`,
+			want:   `{"cache": {"ttl": 60}, "ssh": {"user": "alice"}}`,
+		},
+		{
+			name:   "maps merged recursively",
+			system: `{"bastion": {"static": {"us-west-2": ["1.1.1.1"]}, "cooldown": 30}}`,
+			usr:    `{"bastion": {"static": {"eu-west-1": ["2.2.2.2"]}}}`,
+			want:   `{"bastion": {"static": {"us-west-2": ["1.1.1.1"], "eu-west-1": ["2.2.2.2"]}, "cooldown": 30}}`,
+		},
+		{
+			name:   "user values replace system ones",
+			system: `{"cache": {"ttl": 60, "disabled": true}, "private_cidrs": ["100.64.0.0/10"]}`,
+			usr:    `{"cache": {"ttl": 120}, "private_cidrs": ["10.0.0.0/8"]}`,
+			want:   `{"cache": {"ttl": 120, "disabled": true}, "private_cidrs": ["10.0.0.0/8"]}`,
+		},
+		{
+			name:   "empty user values replace system ones",
+			system: `{"cache": {"ttl": 60, "disabled": true}, "private_cidrs": ["100.64.0.0/10"], "ssh": {"user": "ec2-user"}}`,
+			usr:    `{"cache": {"ttl": 0, "disabled": false}, "private_cidrs": [], "ssh": {"user": ""}}`,
+			want:   `{"cache": {"ttl": 0, "disabled": false}, "private_cidrs": [], "ssh": {"user": ""}}`,
+		},
+		{
+			name:   "unset user values ignored",
+			system: `{"cache": {"ttl": 60, "disabled": true}, "ssh": {"user": "ec2-user"}}`,
+			usr:    `{"cache": {}, "ssh": {}}`,
+			want:   `{"cache": {"ttl": 60, "disabled": true}, "ssh": {"user": "ec2-user"}}`,
+		},
+		{
+			name:   "empty user values kept without system ones",
+			system: `{}`,
+			usr:    `{"cache": {"ttl": 0}}`,
+			want:   `{"cache": {"ttl": 0}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		got := mergeLayer(genericJSON(t, tt.system), genericJSON(t, tt.usr))
+		if want := genericJSON(t, tt.want); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: mergeLayer() = %v, want %v", tt.name, got, want)
+		}
+	}
+}
+
+func TestSubtractLayer(t *testing.T) {
+	tests := []struct {
+		name   string
+		usr    string
+		system string
+		want   string
+	}{
+		{
+			name:   "system values removed",
+			usr:    `{"version": 2, "cache": {"ttl": 60, "disabled": true}, "ssh": {"user": "alice"}}`,
+			system: `{"version": 2, "cache": {"ttl": 60, "disabled": true}}`,
+			want:   `{"version": 2, "ssh": {"user": "alice"}}`,
+		},
+		{
+			name:   "changed values kept",
+			usr:    `{"cache": {"ttl": 120, "disabled": true}, "private_cidrs": ["10.0.0.0/8"]}`,
+			system: `{"cache": {"ttl": 60, "disabled": true}, "private_cidrs": ["100.64.0.0/10"]}`,
+			want:   `{"cache": {"ttl": 120}, "private_cidrs": ["10.0.0.0/8"]}`,
+		},
+		{
+			name:   "nested maps subtracted",
+			usr:    `{"bastion": {"static": {"us-west-2": ["1.1.1.1"], "eu-west-1": ["2.2.2.2"]}}}`,
+			system: `{"bastion": {"static": {"us-west-2": ["1.1.1.1"]}}}`,
+			want:   `{"bastion": {"static": {"eu-west-1": ["2.2.2.2"]}}}`,
+		},
+		{
+			name:   "user only values kept",
+			usr:    `{"regions": [{"name": "us-east-1"}]}`,
+			system: `{}`,
+			want:   `{"regions": [{"name": "us-east-1"}]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		got := subtractLayer(genericJSON(t, tt.usr), genericJSON(t, tt.system))
+		if want := genericJSON(t, tt.want); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: subtractLayer() = %v, want %v", tt.name, got, want)
+		}
+	}
+}
+
+func TestSubtractMergedLayer(t *testing.T) {
+	system := `{"version": 2, "cache": {"ttl": 60}, "bastion": {"static": {"us-west-2": ["1.1.1.1"]}}}`
+	usr := `{"version": 2, "ssh": {"user": "alice"}, "bastion": {"static": {"eu-west-1": ["2.2.2.2"]}}}`
+
+	merged := mergeLayer(genericJSON(t, system), genericJSON(t, usr))
+	if got, want := subtractLayer(merged, genericJSON(t, system)), genericJSON(t, usr); !reflect.DeepEqual(got, want) {
+		t.Errorf("subtractLayer(mergeLayer()) = %v, want %v", got, want)
+	}
+}
+
+func TestDisabledOverride(t *testing.T) {
+	system := `{"version": 2, "contexts": {"default": {"cache": {"disabled": true}, "auto_discover_regions": true}}}`
+
+	// The values not set in the user config aren't saved, so the system-wide
+	// ones apply.
+	cfg := &Config{}
+	usr, err := genericFile(&File{Contexts: map[string]*Config{DefaultContext: cfg}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	merged := mergeLayer(genericJSON(t, system), subtractLayer(usr, genericJSON(t, system)))
+	if got := mergedConfig(t, merged); !got.Cache.IsDisabled() || !got.GetAutoDiscoverRegions() {
+		t.Errorf("unset values: disabled = %v, auto discover = %v, want true", got.Cache.IsDisabled(), got.GetAutoDiscoverRegions())
+	}
+
+	for _, key := range []string{"cache.disabled", "auto_discover_regions"} {
+		if err = cfg.Set(key, "false"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if usr, err = genericFile(&File{Contexts: map[string]*Config{DefaultContext: cfg}}); err != nil {
+		t.Fatal(err)
+	}
+	merged = mergeLayer(genericJSON(t, system), subtractLayer(usr, genericJSON(t, system)))
+	if got := mergedConfig(t, merged); got.Cache.IsDisabled() || got.GetAutoDiscoverRegions() {
+		t.Errorf("false values: disabled = %v, auto discover = %v, want false", got.Cache.IsDisabled(), got.GetAutoDiscoverRegions())
+	}
+}
+
+// mergedConfig decodes the default context of the merged layers.
+func mergedConfig(t *testing.T, merged map[string]interface{}) *Config {
+	t.Helper()
+
+	data, err := json.Marshal(merged)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &File{}
+	if err = json.Unmarshal(data, f); err != nil {
+		t.Fatal(err)
+	}
+	return f.Contexts[DefaultContext]
+}
+
+func TestDecodeFileLayer(t *testing.T) {
+	f, _, err := decodeFile([]byte(`{"version": 2, "contexts": {"default": {"cache": {"ttl": 0}}}}`), formatJSON, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the values set in the file are in the layer, the empty ones too.
+	want := genericJSON(t, `{"version": 2, "contexts": {"default": {"cache": {"ttl": 0}}}}`)
+	if !reflect.DeepEqual(f.layer, want) {
+		t.Errorf("layer = %v, want %v", f.layer, want)
+	}
+}
@@ -0,0 +1,244 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// CurrentVersion is the version of the config file structure.
+const CurrentVersion = 2
+
+// migration upgrades the decoded config file structure by one version.
+type migration func(raw map[string]interface{}) error
+
+// migrations stores the config file migrations, indexed by the version they
+// upgrade from.
+var migrations = []migration{
+	// Version 0 stores a single configuration, without contexts.
+	migrateToContexts,
+	// Version 1 stores the ip addresses of the bastion hosts only.
+	migrateBastionHosts,
+}
+
+// decodeFile decodes the config file data, migrating it first if it was
+// created by an older version. If any migration was applied, the migrated
+// data is returned and the File version is the one it was migrated from. If
+// strict is set, unknown fields are reported as errors. YAML and TOML data
+// is converted to json first, the errors have no positions then.
+func decodeFile(data []byte, format string, strict bool) (*File, []byte, error) {
+	positions := format == formatJSON
+	data, err := toJSON(data, format)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	raw := map[string]interface{}{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, nil, decodeError(data, err, positions)
+	}
+
+	version := fileVersion(raw)
+	if version > CurrentVersion {
+		return nil, nil, fmt.Errorf("unsupported config file version %d, the latest supported one is %d, upgrade fst", version, CurrentVersion)
+	}
+
+	var migrated []byte
+	if version < CurrentVersion {
+		for i, migrate := range migrations[version:] {
+			if err := migrate(raw); err != nil {
+				return nil, nil, fmt.Errorf("error migrating config file to version %d: %v", version+i+1, err)
+			}
+		}
+		raw["version"] = CurrentVersion
+
+		if migrated, err = json.MarshalIndent(raw, "", "  "); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// The positions of the errors in the migrated data don't match the file.
+	decoded := data
+	if migrated != nil {
+		decoded = migrated
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(decoded))
+	if strict {
+		dec.DisallowUnknownFields()
+	}
+
+	f := &File{}
+	if err := dec.Decode(f); err != nil {
+		return nil, nil, decodeError(decoded, err, positions && migrated == nil)
+	}
+	f.Version = version
+
+	layer, err := decodeGeneric(decoded)
+	if err != nil {
+		return nil, nil, err
+	}
+	f.layer, _ = layer.(map[string]interface{})
+
+	return f, migrated, nil
+}
+
+// fileVersion returns the version of the decoded config file structure.
+// Files created before the version was introduced have none.
+func fileVersion(raw map[string]interface{}) int {
+	if version, ok := raw["version"].(float64); ok {
+		return int(version)
+	}
+	if _, ok := raw["contexts"]; ok {
+		return 1
+	}
+	return 0
+}
+
+// migrateToContexts moves the configuration to the default context.
+func migrateToContexts(raw map[string]interface{}) error {
+	cfg := map[string]interface{}{}
+	for key, value := range raw {
+		cfg[key] = value
+		delete(raw, key)
+	}
+
+	raw["current_context"] = DefaultContext
+	raw["contexts"] = map[string]interface{}{
+		DefaultContext: cfg,
+	}
+	return nil
+}
+
+// migrateBastionHosts replaces the bastion host ip addresses with the bastion
+// host structures.
+func migrateBastionHosts(raw map[string]interface{}) error {
+	contexts, _ := raw["contexts"].(map[string]interface{})
+	for _, cfg := range contexts {
+		cfg, _ := cfg.(map[string]interface{})
+		bastionHosts, _ := cfg["bastion_hosts"].(map[string]interface{})
+		for _, hosts := range bastionHosts {
+			hosts, _ := hosts.([]interface{})
+			for i, host := range hosts {
+				if ip, ok := host.(string); ok {
+					hosts[i] = map[string]interface{}{"ip": ip}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// writeMigrated backs up the original config file and replaces it with the
+// migrated data. The secrets are removed from the backup, they're moved to the
+// secret store from the migrated file.
+func writeMigrated(path string, original, migrated []byte, version int) error {
+	original, err := withoutPlainSecrets(original, fileFormat(path))
+	if err != nil {
+		return fmt.Errorf("error backing up config file: %v", err)
+	}
+
+	backup := fmt.Sprintf("%s.v%d-backup-%s", path, version, time.Now().Format("20060102150405"))
+	if err = ioutil.WriteFile(backup, original, filePermMode); err != nil {
+		return fmt.Errorf("error backing up config file: %v", err)
+	}
+
+	data, err := fromJSON(append(migrated, '\n'), fileFormat(path))
+	if err != nil {
+		return fmt.Errorf("error encoding migrated config file: %v", err)
+	}
+
+	if err := ioutil.WriteFile(path, data, filePermMode); err != nil {
+		return fmt.Errorf("error saving migrated config file: %v", err)
+	}
+	return os.Chmod(path, filePermMode)
+}
+
+// decodeError adds the position of the error in the data to JSON decoding
+// errors, if withPosition is set.
+func decodeError(data []byte, err error, withPosition bool) error {
+	var offset int64
+	switch e := err.(type) {
+	case *json.SyntaxError:
+		offset = e.Offset
+	case *json.UnmarshalTypeError:
+		offset = e.Offset
+		err = fmt.Errorf("invalid value for %s: expected %s, got %s", e.Field, e.Type, e.Value)
+	default:
+		return err
+	}
+
+	if !withPosition {
+		return err
+	}
+
+	line, column := 1, 1
+	for _, b := range data[:offset] {
+		column++
+		if b == '\n' {
+			line++
+			column = 1
+		}
+	}
+	return fmt.Errorf("line %d, column %d: %v", line, column, err)
+}
+
+// withoutPlainSecrets returns the config file data with the secrets removed
+// from all the configurations, of any version. The data is returned unchanged
+// if it has no secrets.
+func withoutPlainSecrets(data []byte, format string) ([]byte, error) {
+	converted, err := toJSON(data, format)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := decodeGeneric(converted)
+	if err != nil {
+		return nil, err
+	}
+	if !removePlainSecrets(raw) {
+		return data, nil
+	}
+
+	if converted, err = json.MarshalIndent(raw, "", "  "); err != nil {
+		return nil, err
+	}
+	return fromJSON(append(converted, '\n'), format)
+}
+
+// removePlainSecrets removes the secrets from the decoded config file
+// structure. Reports whether any were found.
+func removePlainSecrets(v interface{}) bool {
+	found := false
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			fields, ok := value.(map[string]interface{})
+			switch {
+			case ok && key == "aws_credentials":
+				found = deleteNonEmpty(fields, "secret") || found
+			case ok && key == "vpn_config":
+				found = deleteNonEmpty(fields, "otp_secret") || found
+			}
+			found = removePlainSecrets(value) || found
+		}
+	case []interface{}:
+		for _, value := range v {
+			found = removePlainSecrets(value) || found
+		}
+	}
+	return found
+}
+
+// deleteNonEmpty deletes the key from the map if its value is not empty.
+// Reports whether it was deleted.
+func deleteNonEmpty(m map[string]interface{}, key string) bool {
+	if isZero(m[key]) {
+		return false
+	}
+	delete(m, key)
+	return true
+}
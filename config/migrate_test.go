@@ -0,0 +1,184 @@
+package config
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMigrationBackupWithoutSecrets(t *testing.T) {
+	path, cleanup := withConfigFile(t, `{
+  "aws_credentials": {"id": "AKIA", "secret": "aws-secret"},
+  "bastion_hosts": {"us-west-2": ["1.1.1.1"]},
+  "vpn_config": {"profile_id": "p", "otp_secret": "otp-secret"}
+}`)
+	defer cleanup()
+
+	f, err := LoadFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := f.Contexts[DefaultContext].AWSCredentials.Secret; got != "aws-secret" {
+		t.Errorf("migrated aws secret = %q, want aws-secret", got)
+	}
+
+	backups, err := filepath.Glob(path + ".v0-backup-*")
+	if err != nil || len(backups) != 1 {
+		t.Fatalf("backups = %v, %v, want 1", backups, err)
+	}
+
+	data, err := ioutil.ReadFile(backups[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	backup := string(data)
+	for _, secret := range []string{"aws-secret", "otp-secret"} {
+		if strings.Contains(backup, secret) {
+			t.Errorf("backup contains %s:\n%s", secret, backup)
+		}
+	}
+	for _, value := range []string{"AKIA", "1.1.1.1", `"p"`} {
+		if !strings.Contains(backup, value) {
+			t.Errorf("backup is missing %s:\n%s", value, backup)
+		}
+	}
+}
+
+func TestWithoutPlainSecretsUnchanged(t *testing.T) {
+	data := []byte(`{"version": 1, "contexts": {"default": {"aws_credentials": {"id": "AKIA", "secret": ""}}}}`)
+	got, err := withoutPlainSecrets(data, formatJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(data) {
+		t.Errorf("withoutPlainSecrets changed data without secrets: %s", got)
+	}
+}
+
+func TestDecodeFile(t *testing.T) {
+	tests := []struct {
+		name         string
+		data         string
+		format       string
+		strict       bool
+		wantVersion  int
+		wantMigrated bool
+		wantContext  string
+		wantBastions []BastionHost
+		wantErr      string
+	}{
+		{
+			name:         "version 0",
+			data:         `{"bastion_hosts": {"us-west-2": ["1.1.1.1", "2.2.2.2"]}}`,
+			format:       formatJSON,
+			wantVersion:  0,
+			wantMigrated: true,
+			wantContext:  DefaultContext,
+			wantBastions: []BastionHost{{IP: "1.1.1.1"}, {IP: "2.2.2.2"}},
+		},
+		{
+			name:         "version 0 yaml",
+			data:         "bastion_hosts:\n  us-west-2:\n  - 1.1.1.1\n",
+			format:       formatYAML,
+			wantVersion:  0,
+			wantMigrated: true,
+			wantContext:  DefaultContext,
+			wantBastions: []BastionHost{{IP: "1.1.1.1"}},
+		},
+		{
+			name:         "version 1",
+			data:         `{"current_context": "prod", "contexts": {"prod": {"bastion_hosts": {"us-west-2": ["1.1.1.1"]}}}}`,
+			format:       formatJSON,
+			wantVersion:  1,
+			wantMigrated: true,
+			wantContext:  "prod",
+			wantBastions: []BastionHost{{IP: "1.1.1.1"}},
+		},
+		{
+			name:         "current version",
+			data:         `{"version": 2, "current_context": "prod", "contexts": {"prod": {"bastion_hosts": {"us-west-2": [{"ip": "1.1.1.1", "vpc_id": "vpc-1"}]}}}}`,
+			format:       formatJSON,
+			wantVersion:  2,
+			wantContext:  "prod",
+			wantBastions: []BastionHost{{IP: "1.1.1.1", VPCID: "vpc-1"}},
+		},
+		{
+			name:         "current version toml",
+			data:         "version = 2\ncurrent_context = \"prod\"\n\n[[contexts.prod.bastion_hosts.us-west-2]]\nip = \"1.1.1.1\"\n",
+			format:       formatTOML,
+			wantVersion:  2,
+			wantContext:  "prod",
+			wantBastions: []BastionHost{{IP: "1.1.1.1"}},
+		},
+		{
+			name:        "unknown field",
+			data:        `{"version": 2, "current_context": "prod", "unknown": true}`,
+			format:      formatJSON,
+			wantVersion: 2,
+			wantContext: "prod",
+		},
+		{
+			name:    "unknown field strict",
+			data:    `{"version": 2, "current_context": "prod", "unknown": true}`,
+			format:  formatJSON,
+			strict:  true,
+			wantErr: `unknown field "unknown"`,
+		},
+		{
+			name:    "newer version",
+			data:    `{"version": 3}`,
+			format:  formatJSON,
+			wantErr: "unsupported config file version 3",
+		},
+		{
+			name:    "syntax error",
+			data:    "{\n  \"version\": 2,\n}",
+			format:  formatJSON,
+			wantErr: "line 3, column 2",
+		},
+		{
+			name:    "invalid value",
+			data:    "{\"version\": 2,\n  \"current_context\": 1}",
+			format:  formatJSON,
+			wantErr: "line 2, column 23: invalid value for current_context: expected string, got number",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, migrated, err := decodeFile([]byte(tt.data), tt.format, tt.strict)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("decodeFile() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("decodeFile() error: %v", err)
+			}
+
+			if f.Version != tt.wantVersion {
+				t.Errorf("version = %d, want %d", f.Version, tt.wantVersion)
+			}
+			if (migrated != nil) != tt.wantMigrated {
+				t.Errorf("migrated = %s, want migrated: %t", migrated, tt.wantMigrated)
+			}
+			if migrated != nil && !strings.Contains(string(migrated), `"version": 2`) {
+				t.Errorf("migrated data without the current version:\n%s", migrated)
+			}
+			if f.CurrentContext != tt.wantContext {
+				t.Errorf("current context = %q, want %q", f.CurrentContext, tt.wantContext)
+			}
+
+			var bastions []BastionHost
+			if cfg := f.Contexts[tt.wantContext]; cfg != nil {
+				bastions = cfg.BastionHosts["us-west-2"]
+			}
+			if !reflect.DeepEqual(bastions, tt.wantBastions) {
+				t.Errorf("bastion hosts = %+v, want %+v", bastions, tt.wantBastions)
+			}
+		})
+	}
+}
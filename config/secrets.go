@@ -0,0 +1,289 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+
+	"github.com/gr00by87/fst/secrets"
+)
+
+const (
+	// secretsFileName is the name of the encrypted secrets file, stored next
+	// to the config file.
+	secretsFileName = ".fst.secrets"
+
+	// Secret names, the secrets are stored under <context>/<name> keys.
+	secretAWSSecret = "aws_secret"
+	secretOTPSecret = "otp_secret"
+)
+
+// secretKeys stores the config keys of the secrets, by the secret name.
+var secretKeys = map[string]string{
+	secretAWSSecret: "aws_credentials.secret",
+	secretOTPSecret: "vpn_config.otp_secret",
+}
+
+// secretFields returns the config fields kept in the secret store, by the
+// secret name.
+func (c *Config) secretFields() map[string]*string {
+	return map[string]*string{
+		secretAWSSecret: &c.AWSCredentials.Secret,
+		secretOTPSecret: &c.VPNConfig.OTPSecret,
+	}
+}
+
+// hasPlainSecrets reports whether any secret is set in the config.
+func (c *Config) hasPlainSecrets() bool {
+	for _, value := range c.secretFields() {
+		if *value != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// withoutSecrets returns a copy of the config with the secrets removed.
+func (c *Config) withoutSecrets() *Config {
+	stripped := *c
+	for _, value := range stripped.secretFields() {
+		*value = ""
+	}
+	return &stripped
+}
+
+// LoadSecrets reads the secrets of the context from the secret store into
+// the config. Configs created before the secret store was introduced keep
+// the secrets in the config file.
+func LoadSecrets(cfg *Config, context string) error {
+	cfg.secretsLoaded = true
+	if cfg.SecretStore == "" {
+		return nil
+	}
+
+	store, err := openSecretStore(cfg.SecretStore)
+	if err != nil {
+		return err
+	}
+
+	for name, value := range cfg.secretFields() {
+		secret, err := store.Get(secretKey(context, name))
+		if err == secrets.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("error reading %s secret: %v", name, err)
+		}
+		*value = secret
+	}
+	return nil
+}
+
+// secretLoader reads the secrets of a config loaded by LoadFromFile on first
+// use, so the commands that don't need them don't open the secret store, nor
+// ask for the file store passphrase.
+type secretLoader struct {
+	cfg    *Config
+	loaded bool
+	err    error
+}
+
+// deferSecrets makes the config read its secrets on first use.
+func (c *Config) deferSecrets() {
+	loader := &secretLoader{cfg: c}
+	c.secrets = loader
+	c.AWSCredentials.secrets = loader
+	c.VPNConfig.secrets = loader
+}
+
+// load reads the secrets into the config, once. The values overridden by
+// the environment variables are kept, the read ones are saved instead.
+func (l *secretLoader) load() error {
+	if l.loaded {
+		return l.err
+	}
+	l.loaded = true
+
+	stored := &Config{SecretStore: l.cfg.SecretStore}
+	if l.err = LoadSecrets(stored, l.cfg.Context); l.err != nil {
+		return l.err
+	}
+
+	storedFields := stored.secretFields()
+	for name, value := range l.cfg.secretFields() {
+		if override, ok := l.cfg.envOverrides[secretKeys[name]]; ok {
+			override.stored = reflect.ValueOf(*storedFields[name])
+			l.cfg.envOverrides[secretKeys[name]] = override
+			continue
+		}
+		*value = *storedFields[name]
+	}
+	l.cfg.secretsLoaded = true
+	return nil
+}
+
+// ReadSecrets reads the secrets of the config loaded by LoadFromFile from the
+// secret store, if they're not read yet. It's required before the secrets
+// are accessed directly, rather than with AWSCredentials.GetSecret and
+// VPNConfig.GetOTPSecret.
+func (c *Config) ReadSecrets() error {
+	if c.secrets == nil {
+		return nil
+	}
+	return c.secrets.load()
+}
+
+// readSecretKey reads the secrets if the config key is a secret one.
+func (c *Config) readSecretKey(key string) error {
+	for _, secretKey := range secretKeys {
+		if key == secretKey {
+			return c.ReadSecrets()
+		}
+	}
+	return nil
+}
+
+// DeleteSecrets removes the secrets of the context from the secret store.
+func DeleteSecrets(cfg *Config, context string) error {
+	if cfg.SecretStore == "" {
+		return nil
+	}
+
+	store, err := openSecretStore(cfg.SecretStore)
+	if err != nil {
+		return err
+	}
+
+	for name := range cfg.secretFields() {
+		if err = store.Delete(secretKey(context, name)); err != nil {
+			return fmt.Errorf("error removing %s secret: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// storeSecrets writes the secrets of the context to the secret store,
+// selecting the default one if none is set yet. Secrets cleared in a config
+// loaded with LoadSecrets are removed from the store.
+func storeSecrets(cfg *Config, context string) error {
+	if !cfg.secretsLoaded && !cfg.hasPlainSecrets() {
+		return nil
+	}
+
+	kind := cfg.SecretStore
+	if kind == "" {
+		if !cfg.hasPlainSecrets() {
+			return nil
+		}
+		kind = secrets.DefaultKind()
+	}
+
+	store, err := openSecretStore(kind)
+	if err != nil {
+		return err
+	}
+
+	for name, value := range cfg.secretFields() {
+		key := secretKey(context, name)
+		switch {
+		case *value != "":
+			err = store.Set(key, *value)
+		case cfg.secretsLoaded:
+			err = store.Delete(key)
+		}
+		if err != nil {
+			return fmt.Errorf("error storing %s secret: %v", name, err)
+		}
+	}
+
+	cfg.SecretStore = kind
+	return nil
+}
+
+// openedStores stores the secret stores opened by the kind and the config
+// file location, so the file store passphrase is asked for once.
+var openedStores = map[string]secrets.Store{}
+
+// openSecretStore opens the secret store of the kind for the config file.
+// The file store is kept next to the config file. The keyring is shared by
+// all the config files, so its keys are prefixed with the config file
+// location.
+func openSecretStore(kind string) (secrets.Store, error) {
+	configPath, err := FilePath()
+	if err != nil {
+		return nil, err
+	}
+	if configPath, err = filepath.Abs(configPath); err != nil {
+		return nil, err
+	}
+
+	if store, ok := openedStores[kind+":"+configPath]; ok {
+		return store, nil
+	}
+
+	store, err := secrets.Open(kind, filepath.Join(filepath.Dir(configPath), secretsFileName))
+	if err != nil {
+		return nil, err
+	}
+
+	if kind == secrets.KindKeyring {
+		legacy, err := legacyFilePath()
+		if err != nil {
+			return nil, err
+		}
+		store = &prefixedStore{
+			Store:  store,
+			prefix: configPath + ":",
+			legacy: configPath == legacy,
+		}
+	}
+
+	openedStores[kind+":"+configPath] = store
+	return store, nil
+}
+
+// prefixedStore is a secret store with the keys prefixed, used to keep the
+// secrets of many config files in a shared store.
+type prefixedStore struct {
+	secrets.Store
+	prefix string
+	// legacy is set for ~/.fst.cfg, its secrets were stored without the
+	// prefix by older versions. They're moved on first read.
+	legacy bool
+}
+
+// Get implements the secrets.Store interface.
+func (s *prefixedStore) Get(key string) (string, error) {
+	secret, err := s.Store.Get(s.prefix + key)
+	if err != secrets.ErrNotFound || !s.legacy {
+		return secret, err
+	}
+
+	if secret, err = s.Store.Get(key); err != nil {
+		return "", err
+	}
+	if err = s.Store.Set(s.prefix+key, secret); err != nil {
+		return "", err
+	}
+	return secret, s.Store.Delete(key)
+}
+
+// Set implements the secrets.Store interface.
+func (s *prefixedStore) Set(key, value string) error {
+	return s.Store.Set(s.prefix+key, value)
+}
+
+// Delete implements the secrets.Store interface.
+func (s *prefixedStore) Delete(key string) error {
+	if s.legacy {
+		if err := s.Store.Delete(key); err != nil {
+			return err
+		}
+	}
+	return s.Store.Delete(s.prefix + key)
+}
+
+// secretKey returns the key the secret of the context is stored under.
+func secretKey(context, name string) string {
+	return context + "/" + name
+}
@@ -0,0 +1,126 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gr00by87/fst/secrets"
+	keyring "github.com/zalando/go-keyring"
+)
+
+func TestKeyringSecretsPerConfigFile(t *testing.T) {
+	keyring.MockInit()
+
+	dir := os.TempDir()
+	paths := []string{filepath.Join(dir, "fst-a", "config.json"), filepath.Join(dir, "fst-b", "config.json")}
+	for i, path := range paths {
+		SetFile(path)
+		cfg := &Config{SecretStore: secrets.KindKeyring, secretsLoaded: true}
+		cfg.AWSCredentials.Secret = "secret-" + string(rune('a'+i))
+		if err := storeSecrets(cfg, DefaultContext); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer SetFile("")
+
+	for i, path := range paths {
+		SetFile(path)
+		cfg := &Config{SecretStore: secrets.KindKeyring}
+		if err := LoadSecrets(cfg, DefaultContext); err != nil {
+			t.Fatal(err)
+		}
+		if want := "secret-" + string(rune('a'+i)); cfg.AWSCredentials.Secret != want {
+			t.Errorf("%s: secret = %q, want %q", path, cfg.AWSCredentials.Secret, want)
+		}
+	}
+}
+
+func TestKeyringLegacySecretsMoved(t *testing.T) {
+	keyring.MockInit()
+
+	legacy, err := legacyFilePath()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := secrets.NewKeyringStore()
+	key := secretKey(DefaultContext, secretAWSSecret)
+	if err = store.Set(key, "legacy-secret"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Other config files don't see the secrets stored without the prefix.
+	SetFile(filepath.Join(os.TempDir(), "fst-other", "config.json"))
+	cfg := &Config{SecretStore: secrets.KindKeyring}
+	if err = LoadSecrets(cfg, DefaultContext); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.AWSCredentials.Secret != "" {
+		t.Errorf("other config file secret = %q, want empty", cfg.AWSCredentials.Secret)
+	}
+
+	SetFile(legacy)
+	defer SetFile("")
+	cfg = &Config{SecretStore: secrets.KindKeyring}
+	if err = LoadSecrets(cfg, DefaultContext); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.AWSCredentials.Secret != "legacy-secret" {
+		t.Errorf("legacy secret = %q, want legacy-secret", cfg.AWSCredentials.Secret)
+	}
+
+	if _, err = store.Get(key); err != secrets.ErrNotFound {
+		t.Errorf("legacy key not removed: %v", err)
+	}
+	if secret, err := store.Get(legacy + ":" + key); err != nil || secret != "legacy-secret" {
+		t.Errorf("prefixed secret = %q, %v, want legacy-secret", secret, err)
+	}
+}
+
+func TestSecretsReadOnFirstUse(t *testing.T) {
+	_, cleanup := withConfigFile(t, `{"version": 2, "current_context": "default", "contexts": {"default": {"secret_store": "file", "aws_credentials": {"id": "AKIAEXAMPLE"}}}}`)
+	defer cleanup()
+	defer func() { openedStores = map[string]secrets.Store{} }()
+
+	os.Setenv(secrets.PassphraseEnv, "correct horse")
+	cfg := &Config{SecretStore: secrets.KindFile, secretsLoaded: true}
+	cfg.AWSCredentials.Secret = "aws-secret"
+	if err := storeSecrets(cfg, DefaultContext); err != nil {
+		t.Fatal(err)
+	}
+	os.Unsetenv(secrets.PassphraseEnv)
+	openedStores = map[string]secrets.Store{}
+
+	// Without the passphrase the store fails to open, so it mustn't be
+	// opened until the secret is used.
+	cfg, err := LoadFromFile()
+	if err != nil || cfg.AWSCredentials.Secret != "" {
+		t.Fatalf("LoadFromFile() = secret %q, %v, want the secret not read", cfg.AWSCredentials.Secret, err)
+	}
+	if _, err = cfg.AWSCredentials.GetSecret(); err == nil {
+		t.Error("GetSecret() without the passphrase succeeded")
+	}
+
+	os.Setenv("FST_AWS_CREDENTIALS_SECRET", "env-secret")
+	cfg, err = LoadFromFile()
+	os.Unsetenv("FST_AWS_CREDENTIALS_SECRET")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secret, err := cfg.AWSCredentials.GetSecret(); err != nil || secret != "env-secret" {
+		t.Errorf("overridden GetSecret() = %q, %v, want env-secret", secret, err)
+	}
+
+	os.Setenv(secrets.PassphraseEnv, "correct horse")
+	defer os.Unsetenv(secrets.PassphraseEnv)
+	if cfg, err = LoadFromFile(); err != nil {
+		t.Fatal(err)
+	}
+	if secret, err := cfg.AWSCredentials.GetSecret(); err != nil || secret != "aws-secret" {
+		t.Errorf("GetSecret() = %q, %v, want aws-secret", secret, err)
+	}
+	if secret, err := cfg.VPNConfig.GetOTPSecret(); err != nil || secret != "" {
+		t.Errorf("GetOTPSecret() = %q, %v, want empty", secret, err)
+	}
+}
@@ -0,0 +1,144 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"sort"
+
+	"github.com/gr00by87/fst/secrets"
+)
+
+// ValidateFile checks the config file without migrating it. If path is
+// empty, the user config file is checked, along with the contexts of the
+// system-wide one it can refer to. Returns the version of the file and all
+// the problems found.
+func ValidateFile(path string) (int, []error) {
+	var system *File
+	if path == "" {
+		var err error
+		if path, err = FilePath(); err != nil {
+			return 0, []error{err}
+		}
+		if systemPath := SystemFilePath(); systemPath != "" {
+			if system, err = loadLayer(systemPath, false); err != nil {
+				return 0, []error{err}
+			}
+		}
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, []error{err}
+	}
+
+	f, _, err := decodeFile(data, fileFormat(path), true)
+	if err != nil {
+		return 0, []error{err}
+	}
+
+	if system != nil {
+		if f.Contexts == nil {
+			f.Contexts = map[string]*Config{}
+		}
+		for name, cfg := range system.Contexts {
+			if _, ok := f.Contexts[name]; !ok {
+				f.Contexts[name] = cfg
+			}
+		}
+	}
+	return f.Version, f.Validate()
+}
+
+// Validate checks the config file values.
+func (f *File) Validate() []error {
+	errs := []error{}
+	if _, ok := f.Contexts[f.CurrentContext]; f.CurrentContext != "" && !ok {
+		errs = append(errs, fmt.Errorf("current_context: context not found: %s", f.CurrentContext))
+	}
+
+	names := []string{}
+	for name := range f.Contexts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if f.Contexts[name] == nil {
+			errs = append(errs, fmt.Errorf("contexts.%s: empty context", name))
+			continue
+		}
+		for _, err := range f.Contexts[name].Validate() {
+			errs = append(errs, fmt.Errorf("contexts.%s.%v", name, err))
+		}
+	}
+	return errs
+}
+
+// Validate checks the config values.
+func (c *Config) Validate() []error {
+	errs := []error{}
+	addErr := func(field, format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf("%s: %s", field, fmt.Sprintf(format, args...)))
+	}
+
+	if source := c.AWSCredentials.Source; source != "" && !contains(CredentialSources, source) {
+		addErr("aws_credentials.source", "unknown source %q, one of: %v", source, CredentialSources)
+	}
+
+	for i, region := range c.Regions {
+		if region.Name == "" {
+			addErr(fmt.Sprintf("regions[%d].name", i), "empty region name")
+		}
+	}
+
+	for region, hosts := range c.BastionHosts {
+		for i, host := range hosts {
+			if host.IP == "" {
+				addErr(fmt.Sprintf("bastion_hosts.%s[%d].ip", region, i), "empty ip address")
+			}
+		}
+	}
+
+	for _, cidr := range c.PrivateCIDRs {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			addErr("private_cidrs", "invalid cidr %q", cidr)
+		}
+	}
+
+	if c.Cache.TTL < 0 {
+		addErr("cache.ttl", "negative ttl %d", c.Cache.TTL)
+	}
+	if c.Bastion.ProbeTimeout < 0 {
+		addErr("bastion.probe_timeout", "negative timeout %d", c.Bastion.ProbeTimeout)
+	}
+	if c.Bastion.Cooldown < 0 {
+		addErr("bastion.cooldown", "negative cooldown %d", c.Bastion.Cooldown)
+	}
+
+	if c.SSH.Template != "" {
+		if _, err := os.Stat(c.SSH.Template); err != nil {
+			addErr("ssh.template", "%v", err)
+		}
+	}
+
+	if store := c.SecretStore; store != "" && store != secrets.KindKeyring && store != secrets.KindFile {
+		addErr("secret_store", "unknown secret store %q, one of: %s, %s", store, secrets.KindKeyring, secrets.KindFile)
+	}
+
+	sort.Slice(errs, func(i, j int) bool {
+		return errs[i].Error() < errs[j].Error()
+	})
+	return errs
+}
+
+// contains reports whether the slice contains the value.
+func contains(slice []string, value string) bool {
+	for _, item := range slice {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,268 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultCacheTTL is the default time after which cached servers expire.
+	DefaultCacheTTL = time.Hour
+
+	cacheFileExt = ".json"
+)
+
+// cacheEntry stores the cached servers of a single region.
+type cacheEntry struct {
+	UpdatedAt time.Time `json:"updated_at"`
+	Servers   []Server  `json:"servers"`
+}
+
+// CacheStatus stores the status of a single region cache entry.
+type CacheStatus struct {
+	Region    string
+	UpdatedAt time.Time
+	Servers   int
+	Expired   bool
+}
+
+// CachedProvider is a Provider that stores the servers retrieved from another
+// provider on disk, one file per region, and serves them until they expire.
+type CachedProvider struct {
+	provider Provider
+	dir      string
+	ttl      time.Duration
+	refresh  bool
+}
+
+// NewCachedProvider creates a new CachedProvider. If refresh is set, the
+// cached servers are ignored and replaced by fresh ones.
+func NewCachedProvider(provider Provider, dir string, ttl time.Duration, refresh bool) *CachedProvider {
+	return &CachedProvider{
+		provider: provider,
+		dir:      dir,
+		ttl:      ttl,
+		refresh:  refresh,
+	}
+}
+
+// DefaultCacheDir returns the default cache directory location.
+func DefaultCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "fst"), nil
+}
+
+// ListServers retrieves all servers from given regions and filters them out
+// by provided matchers. Only the regions with missing or expired cache entries
+// are queried. If a region fails to respond, its expired entry is used
+// instead, if there is one.
+func (p *CachedProvider) ListServers(ctx context.Context, regions []string, matchers ...Matcher) ([]Server, error) {
+	var (
+		entries    = map[string]*cacheEntry{}
+		missing    []string
+		regionErrs []*RegionError
+	)
+
+	for _, region := range regions {
+		entry, _ := p.load(region)
+		if entry != nil {
+			entries[region] = entry
+		}
+		if entry == nil || p.refresh || p.expired(entry) {
+			missing = append(missing, region)
+		}
+	}
+
+	if len(missing) > 0 {
+		fresh, err := p.provider.ListServers(ctx, missing)
+
+		failed := map[string]error{}
+		if partialErr, ok := err.(*PartialError); ok {
+			for _, regionErr := range partialErr.Errors {
+				failed[regionErr.Region] = regionErr.Err
+			}
+		} else if err != nil {
+			for _, region := range missing {
+				failed[region] = err
+			}
+		}
+
+		for _, region := range missing {
+			if err, ok := failed[region]; ok {
+				if entries[region] == nil {
+					regionErrs = append(regionErrs, &RegionError{
+						Region: region,
+						Err:    err,
+					})
+				}
+				continue
+			}
+
+			entry := &cacheEntry{
+				UpdatedAt: time.Now(),
+				Servers:   []Server{},
+			}
+			for _, server := range fresh {
+				if server.Region == region {
+					entry.Servers = append(entry.Servers, server)
+				}
+			}
+			entries[region] = entry
+
+			// Failing to write the cache is not fatal, the servers will be
+			// retrieved again next time.
+			_ = p.save(region, entry)
+		}
+	}
+
+	if len(regionErrs) > 0 && len(regionErrs) == len(regions) {
+		return nil, fmt.Errorf("failed to query all regions: %s", joinRegionErrors(regionErrs))
+	}
+
+	servers := []Server{}
+	for _, region := range regions {
+		if entry, ok := entries[region]; ok {
+			for _, server := range entry.Servers {
+				if MatchAll(server, matchers...) {
+					servers = append(servers, server)
+				}
+			}
+		}
+	}
+
+	sortServers(servers)
+
+	if len(regionErrs) > 0 {
+		return servers, &PartialError{Errors: regionErrs}
+	}
+	return servers, nil
+}
+
+// FindServers finds all the servers identified by sid in the cached regions.
+// If none are found there, the underlying provider is queried.
+func (p *CachedProvider) FindServers(ctx context.Context, regions []string, sid ServerID) ([]Server, error) {
+	if !p.refresh {
+		servers := []Server{}
+		for _, region := range regions {
+			entry, _ := p.load(region)
+			if entry == nil || p.expired(entry) {
+				continue
+			}
+			for _, server := range entry.Servers {
+				if sid.Matches(server) {
+					servers = append(servers, server)
+				}
+			}
+		}
+
+		if len(servers) > 0 {
+			sortServers(servers)
+			return servers, nil
+		}
+	}
+
+	return p.provider.FindServers(ctx, regions, sid)
+}
+
+// DiscoverRegions returns the regions discovered by the underlying provider.
+func (p *CachedProvider) DiscoverRegions(ctx context.Context) ([]string, error) {
+	discoverer, ok := p.provider.(RegionDiscoverer)
+	if !ok {
+		return nil, errors.New("region discovery not supported")
+	}
+	return discoverer.DiscoverRegions(ctx)
+}
+
+// DiscoverNetworks returns the networks discovered by the underlying
+// provider. Networks are not cached.
+func (p *CachedProvider) DiscoverNetworks(ctx context.Context, regions []string) ([]Network, error) {
+	discoverer, ok := p.provider.(NetworkDiscoverer)
+	if !ok {
+		return nil, errors.New("network discovery not supported")
+	}
+	return discoverer.DiscoverNetworks(ctx, regions)
+}
+
+// Status returns the status of all the cache entries.
+func (p *CachedProvider) Status() ([]CacheStatus, error) {
+	files, err := filepath.Glob(filepath.Join(p.dir, "*"+cacheFileExt))
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := []CacheStatus{}
+	for _, file := range files {
+		region := strings.TrimSuffix(filepath.Base(file), cacheFileExt)
+		entry, err := p.load(region)
+		if err != nil {
+			return nil, err
+		}
+
+		statuses = append(statuses, CacheStatus{
+			Region:    region,
+			UpdatedAt: entry.UpdatedAt,
+			Servers:   len(entry.Servers),
+			Expired:   p.expired(entry),
+		})
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Region < statuses[j].Region
+	})
+
+	return statuses, nil
+}
+
+// Clear removes all the cache entries.
+func (p *CachedProvider) Clear() error {
+	return os.RemoveAll(p.dir)
+}
+
+// expired reports whether the cache entry is older than the ttl.
+func (p *CachedProvider) expired(entry *cacheEntry) bool {
+	return time.Since(entry.UpdatedAt) > p.ttl
+}
+
+// load reads the region cache entry from file.
+func (p *CachedProvider) load(region string) (*cacheEntry, error) {
+	data, err := ioutil.ReadFile(p.path(region))
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &cacheEntry{}
+	if err = json.Unmarshal(data, entry); err != nil {
+		return nil, errors.Wrapf(err, "error decoding cache file for region %s", region)
+	}
+	return entry, nil
+}
+
+// save writes the region cache entry to file.
+func (p *CachedProvider) save(region string, entry *cacheEntry) error {
+	if err := os.MkdirAll(p.dir, 0700); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(p.path(region), data, 0600)
+}
+
+// path returns the region cache file path.
+func (p *CachedProvider) path(region string) string {
+	return filepath.Join(p.dir, region+cacheFileExt)
+}
@@ -0,0 +1,288 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeProvider is a Provider serving one server per region, recording the
+// queried regions.
+type fakeProvider struct {
+	failing map[string]bool
+
+	mu      sync.Mutex
+	queried []string
+}
+
+// ListServers implements the Provider interface.
+func (p *fakeProvider) ListServers(ctx context.Context, regions []string, matchers ...Matcher) ([]Server, error) {
+	results, err := queryRegions(ctx, regions, func(_ context.Context, region string) ([]Server, error) {
+		p.mu.Lock()
+		p.queried = append(p.queried, region)
+		p.mu.Unlock()
+
+		if p.failing[region] {
+			return nil, errors.New("access denied")
+		}
+		return []Server{{Name: "fresh-" + region, Region: region, PrivateIP: "10.0.0.1"}}, nil
+	})
+
+	servers := []Server{}
+	for _, result := range results {
+		servers = append(servers, result...)
+	}
+	return servers, err
+}
+
+// FindServers implements the Provider interface.
+func (p *fakeProvider) FindServers(ctx context.Context, regions []string, sid ServerID) ([]Server, error) {
+	servers, _ := p.ListServers(ctx, regions)
+	found := []Server{}
+	for _, server := range servers {
+		if sid.Matches(server) {
+			found = append(found, server)
+		}
+	}
+	return found, nil
+}
+
+// queriedRegions returns the sorted regions queried so far.
+func (p *fakeProvider) queriedRegions() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	sort.Strings(p.queried)
+	return strings.Join(p.queried, ",")
+}
+
+// newTestCache creates a CachedProvider in a temporary directory, with the
+// entries of the regions updated the given time ago.
+func newTestCache(t *testing.T, provider Provider, refresh bool, cached map[string]time.Duration) (*CachedProvider, func()) {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "fst-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cache := NewCachedProvider(provider, dir, time.Hour, refresh)
+	for region, age := range cached {
+		entry := &cacheEntry{
+			UpdatedAt: time.Now().Add(-age),
+			Servers:   []Server{{Name: "cached-" + region, Region: region, PrivateIP: "10.0.0.2"}},
+		}
+		if err = cache.save(region, entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return cache, func() {
+		os.RemoveAll(dir)
+	}
+}
+
+func TestCachedProviderListServers(t *testing.T) {
+	tests := []struct {
+		name        string
+		cached      map[string]time.Duration
+		failing     []string
+		refresh     bool
+		wantQueried string
+		wantServers string
+		wantFailed  string
+		wantErr     bool
+	}{
+		{
+			name:        "empty cache",
+			wantQueried: "eu-west-1,us-east-1",
+			wantServers: "fresh-us-east-1,fresh-eu-west-1",
+		},
+		{
+			name:        "fresh entries",
+			cached:      map[string]time.Duration{"us-east-1": time.Minute, "eu-west-1": time.Minute},
+			wantServers: "cached-us-east-1,cached-eu-west-1",
+		},
+		{
+			name:        "expired entry",
+			cached:      map[string]time.Duration{"us-east-1": 2 * time.Hour, "eu-west-1": time.Minute},
+			wantQueried: "us-east-1",
+			wantServers: "fresh-us-east-1,cached-eu-west-1",
+		},
+		{
+			name:        "refresh",
+			cached:      map[string]time.Duration{"us-east-1": time.Minute, "eu-west-1": time.Minute},
+			refresh:     true,
+			wantQueried: "eu-west-1,us-east-1",
+			wantServers: "fresh-us-east-1,fresh-eu-west-1",
+		},
+		{
+			name:        "expired entry of a failing region is used",
+			cached:      map[string]time.Duration{"us-east-1": 2 * time.Hour},
+			failing:     []string{"us-east-1"},
+			wantQueried: "eu-west-1,us-east-1",
+			wantServers: "cached-us-east-1,fresh-eu-west-1",
+		},
+		{
+			name:        "failing region without entry",
+			failing:     []string{"us-east-1"},
+			wantQueried: "eu-west-1,us-east-1",
+			wantServers: "fresh-eu-west-1",
+			wantFailed:  "us-east-1",
+		},
+		{
+			name:        "all regions failing",
+			failing:     []string{"us-east-1", "eu-west-1"},
+			wantQueried: "eu-west-1,us-east-1",
+			wantErr:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := &fakeProvider{failing: map[string]bool{}}
+			for _, region := range tt.failing {
+				provider.failing[region] = true
+			}
+
+			cache, cleanup := newTestCache(t, provider, tt.refresh, tt.cached)
+			defer cleanup()
+
+			servers, err := cache.ListServers(context.Background(), []string{"us-east-1", "eu-west-1"})
+			if got := provider.queriedRegions(); got != tt.wantQueried {
+				t.Errorf("queried regions = %q, want %q", got, tt.wantQueried)
+			}
+
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				if _, ok := err.(*PartialError); ok {
+					t.Fatalf("error = %v, want a plain error", err)
+				}
+				return
+			}
+
+			failed := ""
+			if partialErr, ok := err.(*PartialError); ok {
+				failed = partialErr.Errors[0].Region
+			} else if err != nil {
+				t.Fatalf("ListServers error: %v", err)
+			}
+			if failed != tt.wantFailed {
+				t.Errorf("failed region = %q, want %q", failed, tt.wantFailed)
+			}
+
+			// Servers are sorted by name.
+			names := []string{}
+			for _, server := range servers {
+				names = append(names, server.Name)
+			}
+			want := strings.Split(tt.wantServers, ",")
+			sort.Slice(want, func(i, j int) bool { return want[i] < want[j] })
+			if strings.Join(names, ",") != strings.Join(want, ",") {
+				t.Errorf("servers = %v, want %v", names, want)
+			}
+		})
+	}
+}
+
+func TestCachedProviderSavesFreshEntries(t *testing.T) {
+	provider := &fakeProvider{failing: map[string]bool{"eu-west-1": true}}
+	cache, cleanup := newTestCache(t, provider, false, nil)
+	defer cleanup()
+
+	regions := []string{"us-east-1", "eu-west-1"}
+	cache.ListServers(context.Background(), regions)
+	cache.ListServers(context.Background(), regions)
+
+	// The failing region is not cached, so it's queried again.
+	if got, want := provider.queriedRegions(), "eu-west-1,eu-west-1,us-east-1"; got != want {
+		t.Errorf("queried regions = %q, want %q", got, want)
+	}
+
+	statuses, err := cache.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 1 || statuses[0].Region != "us-east-1" || statuses[0].Servers != 1 || statuses[0].Expired {
+		t.Errorf("Status() = %+v, want one fresh us-east-1 entry", statuses)
+	}
+
+	if err = cache.Clear(); err != nil {
+		t.Fatal(err)
+	}
+	if statuses, err = cache.Status(); err != nil || len(statuses) != 0 {
+		t.Errorf("Status() after Clear = %+v, %v, want no entries", statuses, err)
+	}
+}
+
+func TestCachedProviderFindServers(t *testing.T) {
+	tests := []struct {
+		name        string
+		cached      map[string]time.Duration
+		refresh     bool
+		id          string
+		wantQueried string
+		wantServers string
+	}{
+		{
+			name:        "cached server",
+			cached:      map[string]time.Duration{"us-east-1": time.Minute},
+			id:          "cached-us-east-1",
+			wantServers: "cached-us-east-1",
+		},
+		{
+			name:        "expired entry",
+			cached:      map[string]time.Duration{"us-east-1": 2 * time.Hour},
+			id:          "fresh-us-east-1",
+			wantQueried: "us-east-1",
+			wantServers: "fresh-us-east-1",
+		},
+		{
+			name:        "not cached",
+			cached:      map[string]time.Duration{"us-east-1": time.Minute},
+			id:          "fresh-us-east-1",
+			wantQueried: "us-east-1",
+			wantServers: "fresh-us-east-1",
+		},
+		{
+			name:        "refresh",
+			cached:      map[string]time.Duration{"us-east-1": time.Minute},
+			refresh:     true,
+			id:          "cached-us-east-1",
+			wantQueried: "us-east-1",
+			wantServers: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := &fakeProvider{}
+			cache, cleanup := newTestCache(t, provider, tt.refresh, tt.cached)
+			defer cleanup()
+
+			servers, err := cache.FindServers(context.Background(), []string{"us-east-1"}, NewServerID(tt.id))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := provider.queriedRegions(); got != tt.wantQueried {
+				t.Errorf("queried regions = %q, want %q", got, tt.wantQueried)
+			}
+
+			names := []string{}
+			for _, server := range servers {
+				names = append(names, server.Name)
+			}
+			if strings.Join(names, ",") != tt.wantServers {
+				t.Errorf("servers = %v, want %v", names, tt.wantServers)
+			}
+		})
+	}
+}
@@ -0,0 +1,277 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/gr00by87/fst/config"
+)
+
+const (
+	// defaultAPIRegion is the region used for the region independent API
+	// calls if none is set in the shared config.
+	defaultAPIRegion = "us-east-1"
+
+	// defaultPlatform is the platform of instances with no platform set, EC2
+	// only sets it for windows instances.
+	defaultPlatform = "linux"
+)
+
+// EC2Provider is a Provider that retrieves servers from AWS EC2.
+type EC2Provider struct {
+	awsCfg config.AWSCredentials
+
+	sessOnce sync.Once
+	sess     *session.Session
+	sessErr  error
+}
+
+// NewEC2Provider creates a new EC2Provider.
+func NewEC2Provider(awsCfg config.AWSCredentials) *EC2Provider {
+	return &EC2Provider{
+		awsCfg: awsCfg,
+	}
+}
+
+// ListServers retrieves all servers from given regions and filters them out
+// by provided matchers. The regions are queried concurrently.
+func (p *EC2Provider) ListServers(ctx context.Context, regions []string, matchers ...Matcher) ([]Server, error) {
+	results, err := queryRegions(ctx, regions, func(ctx context.Context, region string) ([]Server, error) {
+		return p.getFromRegion(ctx, region, &ec2.DescribeInstancesInput{}, matchers...)
+	})
+	if results == nil {
+		return nil, err
+	}
+
+	servers := []Server{}
+	for _, fromRegion := range results {
+		servers = append(servers, fromRegion...)
+	}
+
+	sortServers(servers)
+
+	return servers, err
+}
+
+// FindServers finds all the servers identified by sid querying given regions
+// concurrently. Returns an empty slice if no server is found.
+func (p *EC2Provider) FindServers(ctx context.Context, regions []string, sid ServerID) ([]Server, error) {
+	dii := &ec2.DescribeInstancesInput{
+		Filters: []*ec2.Filter{
+			&ec2.Filter{
+				Name: aws.String(sid.Type),
+				Values: []*string{
+					aws.String(sid.ID),
+				},
+			},
+		},
+	}
+
+	results, err := queryRegions(ctx, regions, func(ctx context.Context, region string) ([]Server, error) {
+		return p.getFromRegion(ctx, region, dii)
+	})
+
+	servers := []Server{}
+	for _, fromRegion := range results {
+		servers = append(servers, fromRegion...)
+	}
+
+	// The server might exist in one of the failed regions.
+	if len(servers) == 0 && err != nil {
+		return nil, err
+	}
+
+	sortServers(servers)
+
+	return servers, nil
+}
+
+// DiscoverRegions returns the names of all the regions enabled in the account.
+func (p *EC2Provider) DiscoverRegions(ctx context.Context) ([]string, error) {
+	sess, err := p.session()
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := aws.NewConfig()
+	if aws.StringValue(sess.Config.Region) == "" {
+		cfg = cfg.WithRegion(defaultAPIRegion)
+	}
+
+	out, err := ec2.New(sess, cfg).DescribeRegionsWithContext(ctx, &ec2.DescribeRegionsInput{})
+	if err != nil {
+		return nil, err
+	}
+
+	regions := []string{}
+	for _, region := range out.Regions {
+		regions = append(regions, aws.StringValue(region.RegionName))
+	}
+	sort.Strings(regions)
+
+	return regions, nil
+}
+
+// CallerIdentity returns the ARN of the identity the AWS credentials belong
+// to. It fails if the credentials are not valid.
+func (p *EC2Provider) CallerIdentity(ctx context.Context) (string, error) {
+	sess, err := p.session()
+	if err != nil {
+		return "", err
+	}
+
+	cfg := aws.NewConfig()
+	if aws.StringValue(sess.Config.Region) == "" {
+		cfg = cfg.WithRegion(defaultAPIRegion)
+	}
+
+	out, err := sts.New(sess, cfg).GetCallerIdentityWithContext(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return "", err
+	}
+	return aws.StringValue(out.Arn), nil
+}
+
+// CheckDescribeInstances checks that the AWS credentials are allowed to
+// describe the instances of the region, using a dry run request.
+func (p *EC2Provider) CheckDescribeInstances(ctx context.Context, region string) error {
+	sess, err := p.session()
+	if err != nil {
+		return err
+	}
+
+	_, err = ec2.New(sess, aws.NewConfig().WithRegion(region)).DescribeInstancesWithContext(ctx, &ec2.DescribeInstancesInput{
+		DryRun: aws.Bool(true),
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == "DryRunOperation" {
+		return nil
+	}
+	if err == nil {
+		return errors.New("unexpected dry run result")
+	}
+	return err
+}
+
+// DiscoverNetworks returns the VPCs of given regions with all their IPv4
+// CIDR blocks.
+func (p *EC2Provider) DiscoverNetworks(ctx context.Context, regions []string) ([]Network, error) {
+	sess, err := p.session()
+	if err != nil {
+		return nil, err
+	}
+
+	networks := []Network{}
+	for _, region := range regions {
+		svc := ec2.New(sess, aws.NewConfig().WithRegion(region))
+		if err = svc.DescribeVpcsPagesWithContext(ctx, &ec2.DescribeVpcsInput{}, func(out *ec2.DescribeVpcsOutput, _ bool) bool {
+			for _, vpc := range out.Vpcs {
+				network := Network{
+					Region: region,
+					VPCID:  ptrToString(vpc.VpcId),
+				}
+				for _, assoc := range vpc.CidrBlockAssociationSet {
+					network.CIDRs = append(network.CIDRs, ptrToString(assoc.CidrBlock))
+				}
+				if len(network.CIDRs) == 0 {
+					network.CIDRs = append(network.CIDRs, ptrToString(vpc.CidrBlock))
+				}
+				networks = append(networks, network)
+			}
+			return true
+		}); err != nil {
+			return nil, &RegionError{Region: region, Err: err}
+		}
+	}
+
+	sort.Slice(networks, func(i, j int) bool {
+		if networks[i].Region != networks[j].Region {
+			return networks[i].Region < networks[j].Region
+		}
+		return networks[i].VPCID < networks[j].VPCID
+	})
+
+	return networks, nil
+}
+
+// getFromRegion retrieves servers from a given region and filters them out
+// by provided matchers.
+func (p *EC2Provider) getFromRegion(ctx context.Context, region string, dii *ec2.DescribeInstancesInput, matchers ...Matcher) ([]Server, error) {
+	sess, err := p.session()
+	if err != nil {
+		return nil, err
+	}
+	svc := ec2.New(sess, aws.NewConfig().WithRegion(region))
+
+	instances, err := svc.DescribeInstancesWithContext(ctx, dii)
+	if err != nil {
+		return nil, err
+	}
+
+	servers := []Server{}
+	for _, res := range instances.Reservations {
+		for _, instance := range res.Instances {
+			server := Server{
+				Region:       region,
+				PrivateIP:    ptrToString(instance.PrivateIpAddress),
+				PublicIP:     ptrToString(instance.PublicIpAddress),
+				InstanceID:   ptrToString(instance.InstanceId),
+				InstanceType: ptrToString(instance.InstanceType),
+				LaunchTime:   aws.TimeValue(instance.LaunchTime),
+				VPCID:        ptrToString(instance.VpcId),
+				SubnetID:     ptrToString(instance.SubnetId),
+				ImageID:      ptrToString(instance.ImageId),
+				KeyName:      ptrToString(instance.KeyName),
+				Platform:     ptrToString(instance.Platform),
+				Tags:         map[string]string{},
+			}
+			if instance.State != nil {
+				server.State = ptrToString(instance.State.Name)
+			}
+			if instance.Placement != nil {
+				server.AvailabilityZone = ptrToString(instance.Placement.AvailabilityZone)
+			}
+			if server.Platform == "" {
+				server.Platform = defaultPlatform
+			}
+			for _, tag := range instance.Tags {
+				server.Tags[ptrToString(tag.Key)] = ptrToString(tag.Value)
+			}
+			server.Name = server.Tags[TagName]
+			server.Env = server.Tags[TagEnv]
+			server.Type = server.Tags[TagType]
+
+			// List only servers with private ip address.
+			if server.PrivateIP != "" {
+				if MatchAll(server, matchers...) {
+					servers = append(servers, server)
+				}
+			}
+		}
+	}
+
+	return servers, nil
+}
+
+// session returns the AWS session shared by all the regions, creating it on
+// first use.
+func (p *EC2Provider) session() (*session.Session, error) {
+	p.sessOnce.Do(func() {
+		p.sess, p.sessErr = NewSession(p.awsCfg)
+	})
+	return p.sess, p.sessErr
+}
+
+// ptrToString returns a string value of a pointer to string.
+func ptrToString(ptr *string) string {
+	if ptr != nil {
+		return *ptr
+	}
+	return ""
+}
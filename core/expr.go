@@ -0,0 +1,327 @@
+package core
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Matcher is implemented by server filters.
+type Matcher interface {
+	// Match reports whether the server matches the filter.
+	Match(server Server) bool
+}
+
+// operator stores a comparison operator and the function creating its
+// matching function.
+type operator struct {
+	token string
+	build func(value string, ignoreCase bool) (func(string) bool, error)
+}
+
+// operators stores the supported comparison operators. Each of them can be
+// negated with a `!` prefix, e.g. `!=` or `!~=`.
+var operators = []operator{
+	{token: "*=", build: buildCompareFunc(Contains)},
+	{token: "%=", build: buildCompareFunc(Glob)},
+	{token: "~=", build: buildRegex},
+	{token: "=", build: buildCompareFunc(Equals)},
+}
+
+// comparison is a Matcher comparing the value of a single attribute or tag.
+type comparison struct {
+	name   string
+	negate bool
+	match  func(string) bool
+}
+
+// Match implements the Matcher interface.
+func (c *comparison) Match(server Server) bool {
+	return c.match(server.Attribute(c.name)) != c.negate
+}
+
+// not is a Matcher negating another Matcher.
+type not struct {
+	matcher Matcher
+}
+
+// Match implements the Matcher interface.
+func (n *not) Match(server Server) bool {
+	return !n.matcher.Match(server)
+}
+
+// and is a Matcher matching servers matched by both Matchers.
+type and struct {
+	left, right Matcher
+}
+
+// Match implements the Matcher interface.
+func (a *and) Match(server Server) bool {
+	return a.left.Match(server) && a.right.Match(server)
+}
+
+// or is a Matcher matching servers matched by any of the Matchers.
+type or struct {
+	left, right Matcher
+}
+
+// Match implements the Matcher interface.
+func (o *or) Match(server Server) bool {
+	return o.left.Match(server) || o.right.Match(server)
+}
+
+// ParseExpr parses a filter expression. An expression consists of tag or
+// server attribute comparisons combined with `and`, `or`, `not` (or `!`) and
+// parentheses, e.g.:
+//
+//	env=prod and (type=api or type=worker) and not instance-type*=micro
+//
+// Supported comparison operators are `=` (equals), `*=` (contains), `~=`
+// (regular expression) and `%=` (glob pattern), each of them can be negated
+// with a `!` prefix. Values containing spaces or parentheses must be quoted.
+// Names are case insensitive, see Attributes for the available attributes.
+func ParseExpr(expr string, ignoreCase bool) (Matcher, error) {
+	p := &parser{
+		input:      expr,
+		ignoreCase: ignoreCase,
+	}
+
+	matcher, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	p.skipSpaces()
+	if !p.eof() {
+		return nil, p.errorf("unexpected %q", p.input[p.pos:])
+	}
+
+	return matcher, nil
+}
+
+// parser is a recursive descent filter expression parser.
+type parser struct {
+	input      string
+	pos        int
+	ignoreCase bool
+}
+
+// parseOr parses `or` separated expressions.
+func (p *parser) parseOr() (Matcher, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.consumeKeyword("or") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &or{left: left, right: right}
+	}
+
+	return left, nil
+}
+
+// parseAnd parses `and` separated expressions.
+func (p *parser) parseAnd() (Matcher, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.consumeKeyword("and") {
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &and{left: left, right: right}
+	}
+
+	return left, nil
+}
+
+// parseUnary parses negated expressions, expressions in parentheses and tag
+// comparisons.
+func (p *parser) parseUnary() (Matcher, error) {
+	p.skipSpaces()
+
+	switch {
+	case p.eof():
+		return nil, p.errorf("unexpected end of expression")
+	case p.consumeKeyword("not"), p.consume("!"):
+		matcher, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &not{matcher: matcher}, nil
+	case p.consume("("):
+		matcher, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpaces()
+		if !p.consume(")") {
+			return nil, p.errorf("missing closing parenthesis")
+		}
+		return matcher, nil
+	}
+
+	return p.parseComparison()
+}
+
+// parseComparison parses a single tag comparison.
+func (p *parser) parseComparison() (Matcher, error) {
+	tag, err := p.parseValue(true)
+	if err != nil {
+		return nil, err
+	}
+	if tag == "" {
+		return nil, p.errorf("missing tag name")
+	}
+
+	p.skipSpaces()
+	negate := p.consume("!")
+
+	var op *operator
+	for i := range operators {
+		if p.consume(operators[i].token) {
+			op = &operators[i]
+			break
+		}
+	}
+	if op == nil {
+		return nil, p.errorf("missing comparison operator after %q", tag)
+	}
+
+	p.skipSpaces()
+	value, err := p.parseValue(false)
+	if err != nil {
+		return nil, err
+	}
+
+	match, err := op.build(value, p.ignoreCase)
+	if err != nil {
+		return nil, p.errorf("invalid value %q: %v", value, err)
+	}
+
+	return &comparison{
+		name:   tag,
+		negate: negate,
+		match:  match,
+	}, nil
+}
+
+// parseValue parses a quoted or unquoted tag name or value. Unquoted tag
+// names end at the comparison operator, unquoted values at a space or
+// a closing parenthesis.
+func (p *parser) parseValue(isTag bool) (string, error) {
+	if p.eof() {
+		return "", nil
+	}
+
+	if quote := p.input[p.pos]; quote == '"' || quote == '\'' {
+		p.pos++
+		value := strings.Builder{}
+		for !p.eof() {
+			c := p.input[p.pos]
+			p.pos++
+			switch {
+			case c == '\\' && !p.eof() && p.input[p.pos] == quote:
+				value.WriteByte(quote)
+				p.pos++
+			case c == quote:
+				return value.String(), nil
+			default:
+				value.WriteByte(c)
+			}
+		}
+		return "", p.errorf("missing closing quote")
+	}
+
+	start := p.pos
+	for !p.eof() {
+		c := rune(p.input[p.pos])
+		if unicode.IsSpace(c) || c == ')' || (isTag && strings.ContainsRune("!=*~%(", c)) {
+			break
+		}
+		p.pos++
+	}
+	return p.input[start:p.pos], nil
+}
+
+// consumeKeyword consumes a case insensitive keyword followed by a space, a
+// parenthesis or the end of the input.
+func (p *parser) consumeKeyword(keyword string) bool {
+	p.skipSpaces()
+
+	end := p.pos + len(keyword)
+	if end > len(p.input) || !strings.EqualFold(p.input[p.pos:end], keyword) {
+		return false
+	}
+	if end < len(p.input) {
+		if c := rune(p.input[end]); !unicode.IsSpace(c) && c != '(' && c != '!' {
+			return false
+		}
+	}
+
+	p.pos = end
+	return true
+}
+
+// consume consumes the token if the input continues with it.
+func (p *parser) consume(token string) bool {
+	if strings.HasPrefix(p.input[p.pos:], token) {
+		p.pos += len(token)
+		return true
+	}
+	return false
+}
+
+// skipSpaces skips the white space characters.
+func (p *parser) skipSpaces() {
+	for !p.eof() && unicode.IsSpace(rune(p.input[p.pos])) {
+		p.pos++
+	}
+}
+
+// eof reports whether the whole input has been parsed.
+func (p *parser) eof() bool {
+	return p.pos >= len(p.input)
+}
+
+// errorf returns a parse error pointing to the current position.
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("invalid filter expression at position %d: %s", p.pos+1, fmt.Sprintf(format, args...))
+}
+
+// buildCompareFunc creates a matching function comparing values using
+// compareFunc.
+func buildCompareFunc(compareFunc compareFunc) func(string, bool) (func(string) bool, error) {
+	return func(value string, ignoreCase bool) (func(string) bool, error) {
+		if ignoreCase {
+			value = strings.ToLower(value)
+		}
+		return func(tagValue string) bool {
+			if ignoreCase {
+				tagValue = strings.ToLower(tagValue)
+			}
+			return compareFunc(value, tagValue)
+		}, nil
+	}
+}
+
+// buildRegex creates a matching function comparing values with a regular
+// expression.
+func buildRegex(value string, ignoreCase bool) (func(string) bool, error) {
+	if ignoreCase {
+		value = "(?i)" + value
+	}
+	re, err := regexp.Compile(value)
+	if err != nil {
+		return nil, err
+	}
+	return re.MatchString, nil
+}
@@ -0,0 +1,105 @@
+package core
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseExpr(t *testing.T) {
+	servers := map[string]Server{
+		"api": {
+			Name:         "api-1",
+			Env:          "prod",
+			Type:         "api",
+			Region:       "us-west-2",
+			InstanceType: "t3.large",
+			Tags:         map[string]string{"Team": "core", "Owner": "John Doe"},
+		},
+		"worker": {
+			Name:         "worker-1",
+			Env:          "prod",
+			Type:         "worker",
+			Region:       "eu-west-1",
+			InstanceType: "t3.micro",
+		},
+		"staging": {
+			Name:         "api-2",
+			Env:          "Staging",
+			Type:         "api",
+			Region:       "us-west-2",
+			InstanceType: "t3.micro",
+		},
+	}
+
+	tests := []struct {
+		expr       string
+		ignoreCase bool
+		want       []string
+	}{
+		{expr: "env=prod", want: []string{"api", "worker"}},
+		{expr: "ENV=prod", want: []string{"api", "worker"}},
+		{expr: "env=staging", want: []string{}},
+		{expr: "env=staging", ignoreCase: true, want: []string{"staging"}},
+		{expr: "env!=prod", want: []string{"staging"}},
+		{expr: "name*=api", want: []string{"api", "staging"}},
+		{expr: "name!*=api", want: []string{"worker"}},
+		{expr: "name%=api-?", want: []string{"api", "staging"}},
+		{expr: "name~=^worker-[0-9]+$", want: []string{"worker"}},
+		{expr: "name!~=^api", want: []string{"worker"}},
+		{expr: "instance-type*=micro", want: []string{"worker", "staging"}},
+		{expr: "region=us-west-2 and type=api", want: []string{"api", "staging"}},
+		{expr: "env=prod and (type=api or type=worker) and not instance-type*=micro", want: []string{"api"}},
+		{expr: "type=worker or env=Staging", want: []string{"worker", "staging"}},
+		{expr: "type=worker or env=prod and type=api", want: []string{"api", "worker"}},
+		{expr: "!type=api", want: []string{"worker"}},
+		{expr: "not(type=api)", want: []string{"worker"}},
+		{expr: "NOT type=api AND env=prod", want: []string{"worker"}},
+		{expr: "owner='John Doe'", want: []string{"api"}},
+		{expr: `owner="John Doe"`, want: []string{"api"}},
+		{expr: `owner='it\'s'`, want: []string{}},
+		{expr: "team=", want: []string{"worker", "staging"}},
+		{expr: "  ( team=core )  ", want: []string{"api"}},
+	}
+
+	for _, tt := range tests {
+		matcher, err := ParseExpr(tt.expr, tt.ignoreCase)
+		if err != nil {
+			t.Errorf("ParseExpr(%q) error: %v", tt.expr, err)
+			continue
+		}
+
+		got := []string{}
+		for _, key := range []string{"api", "worker", "staging"} {
+			if matcher.Match(servers[key]) {
+				got = append(got, key)
+			}
+		}
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("ParseExpr(%q) matched %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestParseExprErrors(t *testing.T) {
+	tests := []struct {
+		expr    string
+		wantErr string
+	}{
+		{expr: "", wantErr: "unexpected end of expression"},
+		{expr: "env=prod and", wantErr: "unexpected end of expression"},
+		{expr: "(env=prod", wantErr: "missing closing parenthesis"},
+		{expr: "env=prod)", wantErr: `unexpected ")"`},
+		{expr: "=prod", wantErr: "missing tag name"},
+		{expr: "env prod", wantErr: `missing comparison operator after "env"`},
+		{expr: "env='prod", wantErr: "missing closing quote"},
+		{expr: "name~=[", wantErr: `invalid value "["`},
+		{expr: "env=prod type=api", wantErr: "position 10"},
+	}
+
+	for _, tt := range tests {
+		_, err := ParseExpr(tt.expr, false)
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("ParseExpr(%q) error = %v, want %q", tt.expr, err, tt.wantErr)
+		}
+	}
+}
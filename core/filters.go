@@ -1,6 +1,10 @@
 package core
 
-import "strings"
+import (
+	"path"
+	"regexp"
+	"strings"
+)
 
 const (
 	TagName = "Name"
@@ -11,17 +15,18 @@ const (
 // compareFunc is a function that compares two string values.
 type compareFunc func(string, string) bool
 
-// filter stores the string values to compare with by compareFunc.
-type filter struct {
+// Filter stores the string values to compare with by compareFunc.
+type Filter struct {
 	tag         string
 	values      []string
 	compareFunc compareFunc
 	ignoreCase  bool
 }
 
-// compareValue compares the given value with all the values to compare with.
-func (f *filter) compareValues(tags map[string]*string) bool {
-	tagValue := *tags[f.tag]
+// Match reports whether the server's tag value matches any of the filter
+// values.
+func (f *Filter) Match(server Server) bool {
+	tagValue := server.TagValue(f.tag)
 
 	// First check if tag exists - if it doesn't, filter out the server.
 	if tagValue == "" {
@@ -45,9 +50,9 @@ func (f *filter) compareValues(tags map[string]*string) bool {
 	return false
 }
 
-// NewFilter creates a new filter.
-func NewFilter(tag string, values []string, compareFunc compareFunc, ignoreCase bool) *filter {
-	return &filter{
+// NewFilter creates a new Filter.
+func NewFilter(tag string, values []string, compareFunc compareFunc, ignoreCase bool) *Filter {
+	return &Filter{
 		tag:         tag,
 		values:      values,
 		compareFunc: compareFunc,
@@ -65,10 +70,26 @@ func Contains(given string, toCompareWith string) bool {
 	return strings.Contains(toCompareWith, given)
 }
 
-// checkAllFilters checks the ouput of compareValues of all the filters.
-func checkAllFilters(filters []*filter, tags map[string]*string) bool {
-	for _, filter := range filters {
-		if !filter.compareValues(tags) {
+// Glob reports whether toCompareWith matches the given shell pattern.
+func Glob(given string, toCompareWith string) bool {
+	matched, _ := path.Match(given, toCompareWith)
+	return matched
+}
+
+// Regex reports whether toCompareWith matches the given regular expression.
+// Invalid expressions never match.
+func Regex(given string, toCompareWith string) bool {
+	re, err := regexp.Compile(given)
+	if err != nil {
+		return false
+	}
+	return re.MatchString(toCompareWith)
+}
+
+// MatchAll checks the output of Match of all the matchers.
+func MatchAll(server Server, matchers ...Matcher) bool {
+	for _, matcher := range matchers {
+		if !matcher.Match(server) {
 			return false
 		}
 	}
@@ -0,0 +1,42 @@
+package core
+
+import "net"
+
+// Network stores the address ranges of a network, e.g. an AWS VPC.
+type Network struct {
+	Region string
+	VPCID  string
+	CIDRs  []string
+}
+
+// privateNetworks stores the RFC 1918 private address ranges.
+var privateNetworks = mustParseCIDRs("10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16")
+
+// PrivateNetworks returns the RFC 1918 private address ranges.
+func PrivateNetworks() []*net.IPNet {
+	return append([]*net.IPNet{}, privateNetworks...)
+}
+
+// IsPrivateIP reports whether the ip address belongs to one of the RFC 1918
+// private address ranges or the extra networks.
+func IsPrivateIP(ip net.IP, extra ...*net.IPNet) bool {
+	for _, network := range append(PrivateNetworks(), extra...) {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// mustParseCIDRs parses the CIDR notation networks. Panics if any is invalid.
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	networks := []*net.IPNet{}
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
@@ -0,0 +1,30 @@
+package core
+
+import "context"
+
+// Provider is implemented by server inventories. It allows the commands to
+// list and resolve servers without knowing where the data comes from.
+type Provider interface {
+	// ListServers retrieves all servers from given regions and filters them
+	// out by provided matchers. If some of the regions fail, the servers found
+	// in the remaining ones are returned together with a *PartialError.
+	ListServers(ctx context.Context, regions []string, matchers ...Matcher) ([]Server, error)
+
+	// FindServers finds all the servers identified by sid in given regions.
+	// Returns an empty slice if no server is found.
+	FindServers(ctx context.Context, regions []string, sid ServerID) ([]Server, error)
+}
+
+// RegionDiscoverer is implemented by providers able to list the regions
+// enabled in the account.
+type RegionDiscoverer interface {
+	// DiscoverRegions returns the names of all the enabled regions.
+	DiscoverRegions(ctx context.Context) ([]string, error)
+}
+
+// NetworkDiscoverer is implemented by providers able to list the networks
+// the servers are placed in.
+type NetworkDiscoverer interface {
+	// DiscoverNetworks returns the networks of given regions.
+	DiscoverNetworks(ctx context.Context, regions []string) ([]Network, error)
+}
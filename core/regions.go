@@ -0,0 +1,98 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// maxRegionWorkers limits the number of regions queried concurrently.
+const maxRegionWorkers = 4
+
+// regionQueryFunc retrieves servers from a single region.
+type regionQueryFunc func(ctx context.Context, region string) ([]Server, error)
+
+// RegionError stores an error returned while querying a single region.
+type RegionError struct {
+	Region string
+	Err    error
+}
+
+// Error implements the error interface.
+func (e *RegionError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Region, e.Err)
+}
+
+// PartialError is returned when some of the regions failed to respond. The
+// servers found in the remaining regions are returned alongside it.
+type PartialError struct {
+	Errors []*RegionError
+}
+
+// Error implements the error interface.
+func (e *PartialError) Error() string {
+	return "failed to query regions: " + joinRegionErrors(e.Errors)
+}
+
+// joinRegionErrors joins the region error messages into a single string.
+func joinRegionErrors(errs []*RegionError) string {
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// queryRegions runs queryFunc for every region using a bounded pool of
+// workers. Results are returned in the order of the regions slice. If some of
+// the regions fail, the results from the remaining ones are returned together
+// with a *PartialError. If all of them fail, a plain error is returned.
+func queryRegions(ctx context.Context, regions []string, queryFunc regionQueryFunc) ([][]Server, error) {
+	var (
+		results = make([][]Server, len(regions))
+		errs    = make([]error, len(regions))
+		indexes = make(chan int)
+		wg      sync.WaitGroup
+	)
+
+	workers := maxRegionWorkers
+	if len(regions) < workers {
+		workers = len(regions)
+	}
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				results[i], errs[i] = queryFunc(ctx, regions[i])
+			}
+		}()
+	}
+
+	for i := range regions {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	partialErr := &PartialError{}
+	for i, err := range errs {
+		if err != nil {
+			partialErr.Errors = append(partialErr.Errors, &RegionError{
+				Region: regions[i],
+				Err:    err,
+			})
+		}
+	}
+
+	switch len(partialErr.Errors) {
+	case 0:
+		return results, nil
+	case len(regions):
+		return nil, fmt.Errorf("failed to query all regions: %s", joinRegionErrors(partialErr.Errors))
+	default:
+		return results, partialErr
+	}
+}
@@ -0,0 +1,99 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestQueryRegions(t *testing.T) {
+	tests := []struct {
+		name        string
+		regions     []string
+		failing     []string
+		want        [][]Server
+		wantFailed  []string
+		wantErr     string
+		wantPartial bool
+	}{
+		{
+			name:    "all regions respond",
+			regions: []string{"us-east-1", "us-west-2", "eu-west-1", "eu-central-1", "ap-south-1"},
+			want: [][]Server{
+				{{Name: "us-east-1"}},
+				{{Name: "us-west-2"}},
+				{{Name: "eu-west-1"}},
+				{{Name: "eu-central-1"}},
+				{{Name: "ap-south-1"}},
+			},
+		},
+		{
+			name:        "some regions fail",
+			regions:     []string{"us-east-1", "us-west-2", "eu-west-1"},
+			failing:     []string{"us-west-2", "eu-west-1"},
+			want:        [][]Server{{{Name: "us-east-1"}}, nil, nil},
+			wantFailed:  []string{"us-west-2", "eu-west-1"},
+			wantErr:     "failed to query regions: us-west-2: access denied; eu-west-1: access denied",
+			wantPartial: true,
+		},
+		{
+			name:    "all regions fail",
+			regions: []string{"us-east-1", "us-west-2"},
+			failing: []string{"us-east-1", "us-west-2"},
+			wantErr: "failed to query all regions: us-east-1: access denied; us-west-2: access denied",
+		},
+		{
+			name:    "no regions",
+			regions: []string{},
+			want:    [][]Server{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			failing := map[string]bool{}
+			for _, region := range tt.failing {
+				failing[region] = true
+			}
+
+			got, err := queryRegions(context.Background(), tt.regions, func(_ context.Context, region string) ([]Server, error) {
+				if failing[region] {
+					return nil, errors.New("access denied")
+				}
+				return []Server{{Name: region}}, nil
+			})
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("queryRegions() = %v, want %v", got, tt.want)
+			}
+
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("queryRegions() error: %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Fatalf("queryRegions() error = %v, want %q", err, tt.wantErr)
+			}
+
+			partialErr, ok := err.(*PartialError)
+			if ok != tt.wantPartial {
+				t.Fatalf("queryRegions() error is *PartialError: %t, want %t", ok, tt.wantPartial)
+			}
+			if !ok {
+				return
+			}
+
+			failed := []string{}
+			for _, regionErr := range partialErr.Errors {
+				failed = append(failed, regionErr.Region)
+			}
+			if strings.Join(failed, ",") != strings.Join(tt.wantFailed, ",") {
+				t.Errorf("failed regions = %v, want %v", failed, tt.wantFailed)
+			}
+		})
+	}
+}
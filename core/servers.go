@@ -1,165 +1,165 @@
 package core
 
 import (
-	"fmt"
 	"net"
+	"regexp"
 	"sort"
 	"strings"
-
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/credentials"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/ec2"
-	"github.com/gr00by87/fst/config"
+	"time"
 )
 
 const (
-	idName      = "tag:Name"
-	idPrivateIP = "private-ip-address"
-	idPublicIP  = "ip-address"
-)
+	IDTypeName       = "tag:Name"
+	IDTypePrivateIP  = "private-ip-address"
+	IDTypePublicIP   = "ip-address"
+	IDTypeInstanceID = "instance-id"
 
-// AllowedRegions stores the list of allowed regions.
-var AllowedRegions = []string{"us-east-1", "us-west-2", "eu-west-1", "ap-northeast-1", "ap-southeast-2"}
+	// StateRunning is the state of running instances.
+	StateRunning = "running"
+)
 
 // Server stores server information data.
 type Server struct {
-	Name      string
-	Env       string
-	Type      string
-	Region    string
-	PrivateIP string
-	PublicIP  string
+	Name             string            `json:"name" yaml:"name"`
+	Env              string            `json:"env" yaml:"env"`
+	Type             string            `json:"type" yaml:"type"`
+	Region           string            `json:"region" yaml:"region"`
+	PrivateIP        string            `json:"private_ip" yaml:"private_ip"`
+	PublicIP         string            `json:"public_ip" yaml:"public_ip"`
+	InstanceID       string            `json:"instance_id" yaml:"instance_id"`
+	InstanceType     string            `json:"instance_type" yaml:"instance_type"`
+	State            string            `json:"state" yaml:"state"`
+	LaunchTime       time.Time         `json:"launch_time" yaml:"launch_time"`
+	AvailabilityZone string            `json:"availability_zone" yaml:"availability_zone"`
+	VPCID            string            `json:"vpc_id" yaml:"vpc_id"`
+	SubnetID         string            `json:"subnet_id" yaml:"subnet_id"`
+	ImageID          string            `json:"image_id" yaml:"image_id"`
+	KeyName          string            `json:"key_name" yaml:"key_name"`
+	Platform         string            `json:"platform" yaml:"platform"`
+	Tags             map[string]string `json:"tags" yaml:"tags"`
 }
 
-// serverID stores the server identifier and it's type.
-type serverID struct {
-	typ string
-	id  string
+// Attributes stores the names of the server attributes available in filters,
+// other names refer to tags.
+var Attributes = []string{
+	"region", "private-ip", "public-ip", "instance-id", "instance-type", "state",
+	"launch-time", "az", "vpc-id", "subnet-id", "image-id", "key-name", "platform",
 }
 
-// NewServerID creates a new serverID.
-func NewServerID(id string) serverID {
-	sid := serverID{
-		id:  id,
-		typ: idName,
-	}
-
-	ip := net.ParseIP(id)
-	if ip != nil {
-		if strings.HasPrefix(id, "172.") {
-			sid.typ = idPrivateIP
-		} else {
-			sid.typ = idPublicIP
+// Attribute returns the value of the server attribute with a given name. If
+// there is no such attribute, the value of the tag with that name is
+// returned. Names are case insensitive.
+func (s Server) Attribute(name string) string {
+	switch strings.ToLower(name) {
+	case "region":
+		return s.Region
+	case "private-ip":
+		return s.PrivateIP
+	case "public-ip":
+		return s.PublicIP
+	case "instance-id":
+		return s.InstanceID
+	case "instance-type":
+		return s.InstanceType
+	case "state":
+		return s.State
+	case "launch-time":
+		if s.LaunchTime.IsZero() {
+			return ""
 		}
+		return s.LaunchTime.Format(time.RFC3339)
+	case "az":
+		return s.AvailabilityZone
+	case "vpc-id":
+		return s.VPCID
+	case "subnet-id":
+		return s.SubnetID
+	case "image-id":
+		return s.ImageID
+	case "key-name":
+		return s.KeyName
+	case "platform":
+		return s.Platform
 	}
-
-	return sid
+	return s.TagValue(name)
 }
 
-// GetAllServers retrieves all servers from given regions and filters them out
-// by provided filters.
-func GetAllServers(awsCfg config.AWSCredentials, regions []string, filters ...*filter) (servers []Server, err error) {
-	for _, region := range regions {
-		fromRegion, err := getFromRegion(awsCfg, region, &ec2.DescribeInstancesInput{}, filters...)
-		if err != nil {
-			return nil, err
-		}
-
-		servers = append(servers, fromRegion...)
+// TagValue returns the server's value of a given tag. Tag names are case
+// insensitive.
+func (s Server) TagValue(tag string) string {
+	switch {
+	case strings.EqualFold(tag, TagName):
+		return s.Name
+	case strings.EqualFold(tag, TagEnv):
+		return s.Env
+	case strings.EqualFold(tag, TagType):
+		return s.Type
 	}
 
-	sort.Slice(servers, func(i, j int) bool {
-		if servers[i].Env == servers[j].Env {
-			return strings.ToLower(servers[i].Name) < strings.ToLower(servers[j].Name)
+	if val, ok := s.Tags[tag]; ok {
+		return val
+	}
+	for key, val := range s.Tags {
+		if strings.EqualFold(key, tag) {
+			return val
 		}
-		return servers[i].Env < servers[j].Env
-	})
+	}
+	return ""
+}
 
-	return
+// ServerID stores the server identifier and it's type.
+type ServerID struct {
+	Type string
+	ID   string
 }
 
-// GetSingleServer tries to find a server iterating over all available regions.
-// Returns an error if no server is found.
-func GetSingleServer(awsCfg config.AWSCredentials, sid serverID) (*Server, error) {
-	for _, region := range AllowedRegions {
-
-		servers, err := getFromRegion(awsCfg, region, &ec2.DescribeInstancesInput{
-			Filters: []*ec2.Filter{
-				&ec2.Filter{
-					Name: aws.String(sid.typ),
-					Values: []*string{
-						aws.String(sid.id),
-					},
-				},
-			},
-		})
-		if err != nil {
-			return nil, err
-		}
+// instanceIDRe matches EC2 instance ids, in the short and the long format.
+var instanceIDRe = regexp.MustCompile(`^i-[0-9a-f]{8}([0-9a-f]{9})?$`)
 
-		if len(servers) > 0 {
-			return &servers[0], nil
-		}
+// NewServerID creates a new ServerID. IP addresses are considered private if
+// they belong to the RFC 1918 address ranges or the private networks.
+func NewServerID(id string, privateNetworks ...*net.IPNet) ServerID {
+	sid := ServerID{
+		ID:   id,
+		Type: IDTypeName,
 	}
 
-	return nil, fmt.Errorf("server not found: %s", sid.id)
-}
-
-// getFromRegion retrieves servers from a given region and filters them out
-// by provided filters.
-func getFromRegion(awsCfg config.AWSCredentials, region string, dii *ec2.DescribeInstancesInput, filters ...*filter) ([]Server, error) {
-	creds := credentials.NewStaticCredentials(awsCfg.ID, awsCfg.Secret, "")
-	cfg := aws.NewConfig().WithRegion(region).WithCredentials(creds)
-	svc := ec2.New(session.New(), cfg)
-
-	instances, err := svc.DescribeInstances(dii)
-	if err != nil {
-		return nil, err
+	if instanceIDRe.MatchString(id) {
+		sid.Type = IDTypeInstanceID
 	}
 
-	servers := []Server{}
-	for _, res := range instances.Reservations {
-		for _, instance := range res.Instances {
-			server := Server{
-				Region:    region,
-				PrivateIP: ptrToString(instance.PrivateIpAddress),
-				PublicIP:  ptrToString(instance.PublicIpAddress),
-			}
-
-			tags := map[string]*string{
-				TagName: &server.Name,
-				TagEnv:  &server.Env,
-				TagType: &server.Type,
-			}
-
-			getTagValues(tags, instance.Tags)
-
-			// List only servers with private ip address.
-			if server.PrivateIP != "" {
-				if checkAllFilters(filters, tags) {
-					servers = append(servers, server)
-				}
-			}
+	ip := net.ParseIP(id)
+	if ip != nil {
+		if IsPrivateIP(ip, privateNetworks...) {
+			sid.Type = IDTypePrivateIP
+		} else {
+			sid.Type = IDTypePublicIP
 		}
 	}
 
-	return servers, nil
+	return sid
 }
 
-// getTagValues gets selected tag values from []*ec2.Tag slice.
-func getTagValues(tags map[string]*string, ec2Tags []*ec2.Tag) {
-	for _, tag := range ec2Tags {
-		if val, ok := tags[*tag.Key]; ok {
-			*val = *tag.Value
-		}
+// Matches reports whether the server is identified by sid.
+func (sid ServerID) Matches(server Server) bool {
+	switch sid.Type {
+	case IDTypePrivateIP:
+		return server.PrivateIP == sid.ID
+	case IDTypePublicIP:
+		return server.PublicIP == sid.ID
+	case IDTypeInstanceID:
+		return server.InstanceID == sid.ID
+	default:
+		return server.Name == sid.ID
 	}
 }
 
-// ptrToString returns a string value of a pointer to string.
-func ptrToString(ptr *string) string {
-	if ptr != nil {
-		return *ptr
-	}
-	return ""
+// sortServers sorts servers by environment and then by name.
+func sortServers(servers []Server) {
+	sort.Slice(servers, func(i, j int) bool {
+		if servers[i].Env == servers[j].Env {
+			return strings.ToLower(servers[i].Name) < strings.ToLower(servers[j].Name)
+		}
+		return servers[i].Env < servers[j].Env
+	})
 }
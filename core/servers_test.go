@@ -0,0 +1,34 @@
+package core
+
+import (
+	"net"
+	"testing"
+)
+
+func TestNewServerID(t *testing.T) {
+	_, network, err := net.ParseCIDR("100.64.0.0/10")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		id   string
+		want string
+	}{
+		{id: "api-1", want: IDTypeName},
+		{id: "i-gateway", want: IDTypeName},
+		{id: "i-0123456789", want: IDTypeName},
+		{id: "i-0123456789ABCDEF0", want: IDTypeName},
+		{id: "i-01234567", want: IDTypeInstanceID},
+		{id: "i-0123456789abcdef0", want: IDTypeInstanceID},
+		{id: "10.0.0.1", want: IDTypePrivateIP},
+		{id: "100.64.0.1", want: IDTypePrivateIP},
+		{id: "52.1.2.3", want: IDTypePublicIP},
+	}
+
+	for _, tt := range tests {
+		if got := NewServerID(tt.id, network).Type; got != tt.want {
+			t.Errorf("NewServerID(%q).Type = %q, want %q", tt.id, got, tt.want)
+		}
+	}
+}
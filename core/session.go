@@ -0,0 +1,68 @@
+package core
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/gr00by87/fst/config"
+)
+
+// NewSession creates a new AWS session using the configured credential
+// source. The shared config files are always loaded, so profiles, SSO cached
+// credentials and credential processes work the same way as in the AWS CLI.
+func NewSession(awsCfg config.AWSCredentials) (*session.Session, error) {
+	opts := session.Options{
+		SharedConfigState:       session.SharedConfigEnable,
+		AssumeRoleTokenProvider: stderrTokenProvider,
+	}
+
+	source := awsCfg.GetSource()
+	switch source {
+	case config.CredentialSourceDefault:
+	case config.CredentialSourceStatic:
+		secret, err := awsCfg.GetSecret()
+		if err != nil {
+			return nil, err
+		}
+		opts.Config.Credentials = credentials.NewStaticCredentials(awsCfg.ID, secret, "")
+	case config.CredentialSourceProfile, config.CredentialSourceAssumeRole:
+		opts.Profile = awsCfg.Profile
+	case config.CredentialSourceEnv:
+		opts.Config.Credentials = credentials.NewEnvCredentials()
+	default:
+		return nil, fmt.Errorf("unsupported aws credential source: %s", source)
+	}
+
+	sess, err := session.NewSessionWithOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if source == config.CredentialSourceAssumeRole {
+		creds := stscreds.NewCredentials(sess, awsCfg.RoleARN, func(p *stscreds.AssumeRoleProvider) {
+			if awsCfg.ExternalID != "" {
+				p.ExternalID = aws.String(awsCfg.ExternalID)
+			}
+			if awsCfg.MFASerial != "" {
+				p.SerialNumber = aws.String(awsCfg.MFASerial)
+				p.TokenProvider = stderrTokenProvider
+			}
+		})
+		sess = sess.Copy(aws.NewConfig().WithCredentials(creds))
+	}
+
+	return sess, nil
+}
+
+// stderrTokenProvider asks for the MFA token code on stderr and reads it from
+// stdin, so the prompt doesn't mix with the command output.
+func stderrTokenProvider() (string, error) {
+	var token string
+	fmt.Fprint(os.Stderr, "Assume Role MFA token code: ")
+	_, err := fmt.Scanln(&token)
+	return token, err
+}
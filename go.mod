@@ -3,17 +3,20 @@ module github.com/gr00by87/fst
 go 1.12
 
 require (
+	github.com/BurntSushi/toml v0.3.1
 	github.com/alecthomas/template v0.0.0-20190718012654-fb15b899a751
-	github.com/aws/aws-sdk-go v1.30.4
+	github.com/aws/aws-sdk-go v1.37.0
 	github.com/gorilla/websocket v1.4.0
 	github.com/logrusorgru/aurora v0.0.0-20200102142835-e9ef32dff381
 	github.com/pkg/errors v0.9.1
 	github.com/spf13/cobra v0.0.7
-	github.com/spf13/pflag v1.0.5
+	github.com/spf13/pflag v1.0.5 // indirect
 	github.com/tidwall/gjson v1.6.0
 	github.com/tidwall/pretty v1.0.1 // indirect
 	github.com/xlzd/gotp v0.0.0-20181030022105-c8557ba2c119
-	golang.org/x/crypto v0.0.0-20200403201458-baeed622b8d8 // indirect
-	golang.org/x/net v0.0.0-20200202094626-16171245cfb2
+	github.com/zalando/go-keyring v0.1.1
+	golang.org/x/crypto v0.0.0-20200622213623-75b288015ac9
+	golang.org/x/net v0.0.0-20201110031124-69a78807bb2b
 	gopkg.in/AlecAivazis/survey.v1 v1.8.8
+	gopkg.in/yaml.v2 v2.2.8
 )
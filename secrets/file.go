@@ -0,0 +1,274 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+const (
+	// PassphraseEnv is the environment variable the file store passphrase is
+	// read from, before prompting for it.
+	PassphraseEnv = "FST_PASSPHRASE"
+
+	// scrypt key derivation parameters.
+	scryptN    = 1 << 15
+	scryptR    = 8
+	scryptP    = 1
+	keyLength  = 32
+	saltLength = 16
+
+	// fileVersion is the version of the encrypted file structure.
+	fileVersion = 1
+	// filePermMode is the mode of the encrypted file.
+	filePermMode = 0600
+)
+
+// encryptedFile stores the encrypted file structure.
+type encryptedFile struct {
+	Version int    `json:"version"`
+	Salt    []byte `json:"salt"`
+	Nonce   []byte `json:"nonce"`
+	Data    []byte `json:"data"`
+}
+
+// FileStore is a Store keeping the secrets in a file encrypted with AES-GCM,
+// using a key derived from the passphrase with scrypt. The file is decrypted
+// on first use.
+type FileStore struct {
+	file       string
+	passphrase func(confirm bool) (string, error)
+
+	loaded  bool
+	salt    []byte
+	key     []byte
+	secrets map[string]string
+}
+
+// NewFileStore creates a new FileStore. The passphrase function is called
+// once, with confirm set if the file doesn't exist yet.
+func NewFileStore(file string, passphrase func(confirm bool) (string, error)) *FileStore {
+	return &FileStore{
+		file:       file,
+		passphrase: passphrase,
+	}
+}
+
+// Get implements the Store interface.
+func (s *FileStore) Get(key string) (string, error) {
+	if err := s.load(); err != nil {
+		return "", err
+	}
+
+	value, ok := s.secrets[key]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return value, nil
+}
+
+// Set implements the Store interface.
+func (s *FileStore) Set(key, value string) error {
+	if err := s.load(); err != nil {
+		return err
+	}
+
+	if current, ok := s.secrets[key]; ok && current == value {
+		return nil
+	}
+	s.secrets[key] = value
+	return s.save()
+}
+
+// Delete implements the Store interface.
+func (s *FileStore) Delete(key string) error {
+	if _, err := os.Stat(s.file); os.IsNotExist(err) {
+		return nil
+	}
+	if err := s.load(); err != nil {
+		return err
+	}
+
+	if _, ok := s.secrets[key]; !ok {
+		return nil
+	}
+	delete(s.secrets, key)
+	return s.save()
+}
+
+// load decrypts the file, or derives a key with a new salt if it doesn't
+// exist.
+func (s *FileStore) load() error {
+	if s.loaded {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(s.file)
+	if os.IsNotExist(err) {
+		return s.init()
+	}
+	if err != nil {
+		return err
+	}
+
+	f := &encryptedFile{}
+	if err = json.Unmarshal(data, f); err != nil {
+		return fmt.Errorf("error decoding secrets file: %v", err)
+	}
+	if f.Version != fileVersion {
+		return fmt.Errorf("unsupported secrets file version: %d", f.Version)
+	}
+
+	passphrase, err := s.passphrase(false)
+	if err != nil {
+		return err
+	}
+
+	key, err := deriveKey(passphrase, f.Salt)
+	if err != nil {
+		return err
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return err
+	}
+
+	plain, err := gcm.Open(nil, f.Nonce, f.Data, nil)
+	if err != nil {
+		return errors.New("error decrypting secrets file, invalid passphrase")
+	}
+
+	secrets := map[string]string{}
+	if err = json.Unmarshal(plain, &secrets); err != nil {
+		return fmt.Errorf("error decoding secrets file: %v", err)
+	}
+
+	s.salt, s.key, s.secrets, s.loaded = f.Salt, key, secrets, true
+	return nil
+}
+
+// init derives the key of a new file.
+func (s *FileStore) init() error {
+	passphrase, err := s.passphrase(true)
+	if err != nil {
+		return err
+	}
+
+	salt := make([]byte, saltLength)
+	if _, err = rand.Read(salt); err != nil {
+		return err
+	}
+
+	key, err := deriveKey(passphrase, salt)
+	if err != nil {
+		return err
+	}
+
+	s.salt, s.key, s.secrets, s.loaded = salt, key, map[string]string{}, true
+	return nil
+}
+
+// save encrypts the secrets with a new nonce and writes the file.
+func (s *FileStore) save() error {
+	plain, err := json.Marshal(s.secrets)
+	if err != nil {
+		return err
+	}
+
+	gcm, err := newGCM(s.key)
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(&encryptedFile{
+		Version: fileVersion,
+		Salt:    s.salt,
+		Nonce:   nonce,
+		Data:    gcm.Seal(nil, nonce, plain, nil),
+	})
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(s.file), 0700); err != nil {
+		return err
+	}
+	if err = ioutil.WriteFile(s.file, data, filePermMode); err != nil {
+		return err
+	}
+	// WriteFile doesn't change the mode of existing files.
+	return os.Chmod(s.file, filePermMode)
+}
+
+// deriveKey derives the encryption key from the passphrase.
+func deriveKey(passphrase string, salt []byte) ([]byte, error) {
+	if passphrase == "" {
+		return nil, errors.New("empty passphrase")
+	}
+	return scrypt.Key([]byte(passphrase), salt, scryptN, scryptR, scryptP, keyLength)
+}
+
+// newGCM creates the AES-GCM cipher.
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Passphrase returns the passphrase from the environment variable, or prompts
+// for it on the terminal. If confirm is set, the passphrase has to be entered
+// twice.
+func Passphrase(confirm bool) (string, error) {
+	if passphrase := os.Getenv(PassphraseEnv); passphrase != "" {
+		return passphrase, nil
+	}
+
+	fd := int(os.Stdin.Fd())
+	if !terminal.IsTerminal(fd) {
+		return "", fmt.Errorf("secrets file passphrase required, set %s environment variable", PassphraseEnv)
+	}
+
+	prompt := "Enter secrets file passphrase: "
+	if confirm {
+		prompt = "Enter new secrets file passphrase: "
+	}
+
+	passphrase, err := readPassphrase(fd, prompt)
+	if err != nil || !confirm {
+		return passphrase, err
+	}
+
+	confirmed, err := readPassphrase(fd, "Confirm passphrase: ")
+	if err != nil {
+		return "", err
+	}
+	if confirmed != passphrase {
+		return "", errors.New("passphrases don't match")
+	}
+	return passphrase, nil
+}
+
+// readPassphrase reads the passphrase from the terminal without echo.
+func readPassphrase(fd int, prompt string) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	passphrase, err := terminal.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	return string(passphrase), err
+}
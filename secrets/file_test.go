@@ -0,0 +1,131 @@
+package secrets
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// passphraseFunc returns a passphrase function returning the passphrase and
+// recording the confirm arguments it's called with.
+func passphraseFunc(passphrase string, calls *[]bool) func(bool) (string, error) {
+	return func(confirm bool) (string, error) {
+		*calls = append(*calls, confirm)
+		return passphrase, nil
+	}
+}
+
+func TestFileStoreRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fst-secrets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "nested", ".fst.secrets")
+	secrets := map[string]string{
+		"default/aws_secret": "aws-secret",
+		"default/otp_secret": "otp-secret",
+		"prod/aws_secret":    "prod-secret",
+	}
+
+	calls := []bool{}
+	store := NewFileStore(file, passphraseFunc("correct horse", &calls))
+	for key, value := range secrets {
+		if err = store.Set(key, value); err != nil {
+			t.Fatalf("Set(%q) error: %v", key, err)
+		}
+	}
+	if err = store.Delete("prod/aws_secret"); err != nil {
+		t.Fatalf("Delete error: %v", err)
+	}
+	delete(secrets, "prod/aws_secret")
+
+	if len(calls) != 1 || !calls[0] {
+		t.Errorf("passphrase calls = %v, want a single confirmed one", calls)
+	}
+
+	info, err := os.Stat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != filePermMode {
+		t.Errorf("file mode = %o, want %o", mode, filePermMode)
+	}
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, value := range secrets {
+		if strings.Contains(string(data), value) || strings.Contains(string(data), key) {
+			t.Errorf("file contains %s in plain text", key)
+		}
+	}
+
+	calls = []bool{}
+	reopened := NewFileStore(file, passphraseFunc("correct horse", &calls))
+	for key, want := range secrets {
+		if got, err := reopened.Get(key); err != nil || got != want {
+			t.Errorf("Get(%q) = %q, %v, want %q", key, got, err, want)
+		}
+	}
+	if _, err = reopened.Get("prod/aws_secret"); err != ErrNotFound {
+		t.Errorf("Get(deleted) error = %v, want ErrNotFound", err)
+	}
+	if len(calls) != 1 || calls[0] {
+		t.Errorf("passphrase calls = %v, want a single unconfirmed one", calls)
+	}
+}
+
+func TestFileStoreErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fst-secrets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, ".fst.secrets")
+	calls := []bool{}
+	store := NewFileStore(file, passphraseFunc("correct horse", &calls))
+
+	// Deleting from a missing file doesn't ask for the passphrase.
+	if err = store.Delete("default/aws_secret"); err != nil || len(calls) != 0 {
+		t.Errorf("Delete from missing file = %v with %d passphrase calls, want no error and no calls", err, len(calls))
+	}
+	if err = store.Set("default/aws_secret", "aws-secret"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		passphrase string
+		data       string
+		wantErr    string
+	}{
+		{name: "wrong passphrase", passphrase: "battery staple", wantErr: "invalid passphrase"},
+		{name: "empty passphrase", passphrase: "", wantErr: "empty passphrase"},
+		{name: "unsupported version", passphrase: "correct horse", data: `{"version": 2}`, wantErr: "unsupported secrets file version: 2"},
+		{name: "invalid file", passphrase: "correct horse", data: "{", wantErr: "error decoding secrets file"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := file
+			if tt.data != "" {
+				path = filepath.Join(dir, "invalid.secrets")
+				if err := ioutil.WriteFile(path, []byte(tt.data), filePermMode); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			calls := []bool{}
+			_, err := NewFileStore(path, passphraseFunc(tt.passphrase, &calls)).Get("default/aws_secret")
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Get error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package secrets
+
+import (
+	keyring "github.com/zalando/go-keyring"
+)
+
+// keyringService is the service name the secrets are stored under.
+const keyringService = "fst"
+
+// KeyringStore is a Store using the system keyring.
+type KeyringStore struct {
+	service string
+}
+
+// NewKeyringStore creates a new KeyringStore.
+func NewKeyringStore() *KeyringStore {
+	return &KeyringStore{
+		service: keyringService,
+	}
+}
+
+// Available reports whether the system keyring can be used, e.g. the Secret
+// Service is not running in headless sessions.
+func (s *KeyringStore) Available() bool {
+	_, err := keyring.Get(s.service, "availability-check")
+	return err == nil || err == keyring.ErrNotFound
+}
+
+// Get implements the Store interface.
+func (s *KeyringStore) Get(key string) (string, error) {
+	value, err := keyring.Get(s.service, key)
+	if err == keyring.ErrNotFound {
+		return "", ErrNotFound
+	}
+	return value, err
+}
+
+// Set implements the Store interface.
+func (s *KeyringStore) Set(key, value string) error {
+	return keyring.Set(s.service, key, value)
+}
+
+// Delete implements the Store interface.
+func (s *KeyringStore) Delete(key string) error {
+	err := keyring.Delete(s.service, key)
+	if err == keyring.ErrNotFound {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,53 @@
+// Package secrets stores the secrets kept out of the config file, e.g. the
+// AWS secret access key and the VPN OTP secret.
+package secrets
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Secret store kinds.
+const (
+	// KindKeyring stores the secrets in the system keyring: the freedesktop
+	// Secret Service on Linux, the Keychain on macOS and the Credential
+	// Manager on Windows.
+	KindKeyring = "keyring"
+	// KindFile stores the secrets in a passphrase encrypted file.
+	KindFile = "file"
+)
+
+// ErrNotFound is returned if the secret doesn't exist in the store.
+var ErrNotFound = errors.New("secret not found")
+
+// Store is implemented by secret stores.
+type Store interface {
+	// Get returns the secret stored under the key, or ErrNotFound.
+	Get(key string) (string, error)
+	// Set stores the secret under the key.
+	Set(key, value string) error
+	// Delete removes the secret stored under the key. Removing a missing
+	// secret is not an error.
+	Delete(key string) error
+}
+
+// Open opens the secret store of the kind. The file is used by the file
+// store only.
+func Open(kind, file string) (Store, error) {
+	switch kind {
+	case KindKeyring:
+		return NewKeyringStore(), nil
+	case KindFile:
+		return NewFileStore(file, Passphrase), nil
+	}
+	return nil, fmt.Errorf("unknown secret store: %s", kind)
+}
+
+// DefaultKind returns the keyring store kind if the system keyring is
+// available, otherwise the file store kind.
+func DefaultKind() string {
+	if NewKeyringStore().Available() {
+		return KindKeyring
+	}
+	return KindFile
+}
@@ -0,0 +1,112 @@
+package sshclient
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// knownHostsCallback returns a host key callback verifying the host keys
+// against the known hosts file. Keys of unknown hosts are added to the file,
+// the same way OpenSSH does with `StrictHostKeyChecking accept-new`. Changed
+// keys are rejected.
+func knownHostsCallback(file string) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		if _, err := os.Stat(file); err == nil {
+			callback, err := knownhosts.New(file)
+			if err != nil {
+				return errors.Wrap(err, "error reading known hosts file")
+			}
+
+			err = callback(hostname, remote, key)
+			keyErr, ok := err.(*knownhosts.KeyError)
+			if !ok || len(keyErr.Want) > 0 {
+				if ok {
+					return errors.Errorf("host key verification failed for %s: remote host identification has changed, check %s", hostname, file)
+				}
+				return err
+			}
+		}
+
+		return addKnownHost(file, hostname, key)
+	}
+}
+
+// addKnownHost appends the host key to the known hosts file.
+func addKnownHost(file, hostname string, key ssh.PublicKey) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return errors.Wrap(err, "error creating known hosts directory")
+	}
+
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return errors.Wrap(err, "error opening known hosts file")
+	}
+	defer f.Close()
+
+	if _, err = f.WriteString(knownhosts.Line([]string{knownhosts.Normalize(hostname)}, key) + "\n"); err != nil {
+		return errors.Wrap(err, "error writing known hosts file")
+	}
+
+	warnf("Warning: Permanently added '%s' (%s) to the list of known hosts.", hostname, key.Type())
+	return nil
+}
+
+// knownHostKeyAlgorithms returns the types of the keys known for the address,
+// or nil if there are none, so the default algorithms are used.
+func knownHostKeyAlgorithms(file, addr string) []string {
+	callback, err := knownhosts.New(file)
+	if err != nil {
+		return nil
+	}
+
+	// The known keys are reported by the callback when a key doesn't match.
+	remote := &net.TCPAddr{IP: net.IPv4zero}
+	if host, port, err := net.SplitHostPort(addr); err == nil {
+		if ip := net.ParseIP(host); ip != nil {
+			remote.IP = ip
+			fmt.Sscan(port, &remote.Port)
+		}
+	}
+
+	keyErr, ok := callback(addr, remote, probeKey{}).(*knownhosts.KeyError)
+	if !ok {
+		return nil
+	}
+
+	algorithms, seen := []string{}, map[string]bool{}
+	for _, known := range keyErr.Want {
+		if algorithm := known.Key.Type(); !seen[algorithm] {
+			seen[algorithm] = true
+			algorithms = append(algorithms, algorithm)
+		}
+	}
+	if len(algorithms) == 0 {
+		return nil
+	}
+	return algorithms
+}
+
+// probeKey is a public key matching no known host, used to list the known
+// keys of a host.
+type probeKey struct{}
+
+// Type implements the ssh.PublicKey interface.
+func (probeKey) Type() string {
+	return "fst-probe"
+}
+
+// Marshal implements the ssh.PublicKey interface.
+func (probeKey) Marshal() []byte {
+	return []byte("fst-probe")
+}
+
+// Verify implements the ssh.PublicKey interface.
+func (probeKey) Verify([]byte, *ssh.Signature) error {
+	return errors.New("probe key can't verify signatures")
+}
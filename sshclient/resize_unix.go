@@ -0,0 +1,39 @@
+//go:build !windows
+// +build !windows
+
+package sshclient
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// watchWindowSize propagates the local terminal size changes to the session.
+// The returned function stops watching.
+func watchWindowSize(fd int, session *ssh.Session) func() {
+	sigs := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(sigs, syscall.SIGWINCH)
+
+	go func() {
+		for {
+			select {
+			case <-sigs:
+				if width, height, err := terminal.GetSize(fd); err == nil {
+					session.WindowChange(height, width)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(sigs)
+		close(done)
+	}
+}
@@ -0,0 +1,12 @@
+//go:build windows
+// +build windows
+
+package sshclient
+
+import "golang.org/x/crypto/ssh"
+
+// watchWindowSize is a no-op on windows, which has no window size change
+// signal.
+func watchWindowSize(_ int, _ *ssh.Session) func() {
+	return func() {}
+}
@@ -0,0 +1,73 @@
+package sshclient
+
+import (
+	"os"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// defaultTerm is the terminal type requested if TERM is not set.
+const defaultTerm = "xterm-256color"
+
+// Shell starts an interactive shell session attached to the standard streams.
+// If stdin is a terminal, a pseudo terminal is requested and its size follows
+// the local terminal size. Returns the shell exit status.
+func (c *Client) Shell() (int, error) {
+	session, err := c.newSession()
+	if err != nil {
+		return -1, err
+	}
+	defer session.Close()
+
+	session.Stdin = os.Stdin
+	session.Stdout = os.Stdout
+	session.Stderr = os.Stderr
+
+	fd := int(os.Stdin.Fd())
+	if terminal.IsTerminal(fd) {
+		width, height, err := terminal.GetSize(fd)
+		if err != nil {
+			width, height = 80, 24
+		}
+
+		term := os.Getenv("TERM")
+		if term == "" {
+			term = defaultTerm
+		}
+
+		if err = session.RequestPty(term, height, width, ssh.TerminalModes{
+			ssh.ECHO:          1,
+			ssh.TTY_OP_ISPEED: 14400,
+			ssh.TTY_OP_OSPEED: 14400,
+		}); err != nil {
+			return -1, errors.Wrap(err, "error requesting pty")
+		}
+
+		state, err := terminal.MakeRaw(fd)
+		if err != nil {
+			return -1, errors.Wrap(err, "error setting terminal raw mode")
+		}
+		defer terminal.Restore(fd, state)
+
+		stop := watchWindowSize(fd, session)
+		defer stop()
+	}
+
+	if err = session.Shell(); err != nil {
+		return -1, errors.Wrap(err, "error starting shell")
+	}
+
+	err = session.Wait()
+	if exitErr, ok := err.(*ssh.ExitError); ok {
+		return exitErr.ExitStatus(), nil
+	}
+	if _, ok := err.(*ssh.ExitMissingError); ok {
+		return 0, nil
+	}
+	if err != nil {
+		return -1, errors.Wrap(err, "error waiting for shell")
+	}
+	return 0, nil
+}
@@ -0,0 +1,263 @@
+// Package sshclient implements a native ssh client able to connect to
+// servers through a bastion host, so fst can be used without OpenSSH
+// installed.
+package sshclient
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+const (
+	defaultPort    = "22"
+	defaultTimeout = 10 * time.Second
+)
+
+// defaultIdentityFiles stores the identity files used if none is provided,
+// relative to the user's home directory.
+var defaultIdentityFiles = []string{".ssh/id_rsa", ".ssh/id_ecdsa", ".ssh/id_ed25519"}
+
+// Config stores the native ssh client configuration.
+type Config struct {
+	// User is the login user name, the current user's name is used if it's
+	// not set.
+	User string
+	// IdentityFile is the private key file location. The ssh agent and the
+	// default identity files are used if it's not set.
+	IdentityFile string
+	// KnownHostsFile is the known hosts file location, ~/.ssh/known_hosts is
+	// used if it's not set.
+	KnownHostsFile string
+	// ForwardAgent enables the ssh agent forwarding.
+	ForwardAgent bool
+	// Timeout is the tcp connection timeout.
+	Timeout time.Duration
+}
+
+// Client is a native ssh client connected to a server, optionally through
+// a bastion host.
+type Client struct {
+	cfg     Config
+	bastion *ssh.Client
+	client  *ssh.Client
+	agent   agent.ExtendedAgent
+}
+
+// Dial connects to the host through the bastion host. If bastion is empty,
+// the host is connected directly. Hosts can be passed as `host` or
+// `host:port`.
+func Dial(cfg Config, bastion, host string) (*Client, error) {
+	if cfg.User == "" {
+		usr, err := user.Current()
+		if err != nil {
+			return nil, errors.Wrap(err, "error getting current user")
+		}
+		cfg.User = usr.Username
+	}
+	if cfg.KnownHostsFile == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, errors.Wrap(err, "error getting home directory")
+		}
+		cfg.KnownHostsFile = filepath.Join(home, ".ssh", "known_hosts")
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = defaultTimeout
+	}
+
+	c := &Client{cfg: cfg}
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		if conn, err := net.Dial("unix", sock); err == nil {
+			c.agent = agent.NewClient(conn)
+		}
+	}
+
+	hostAddr := withPort(host)
+	clientCfg, err := c.clientConfig(hostAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	if bastion == "" {
+		c.client, err = ssh.Dial("tcp", hostAddr, clientCfg)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error connecting to %s", host)
+		}
+		return c, c.forwardAgent()
+	}
+
+	bastionAddr := withPort(bastion)
+	bastionCfg, err := c.clientConfig(bastionAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	c.bastion, err = ssh.Dial("tcp", bastionAddr, bastionCfg)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error connecting to bastion host %s", bastion)
+	}
+
+	conn, err := c.bastion.Dial("tcp", hostAddr)
+	if err != nil {
+		c.bastion.Close()
+		return nil, errors.Wrapf(err, "error connecting to %s through bastion host", host)
+	}
+
+	clientConn, chans, reqs, err := ssh.NewClientConn(conn, hostAddr, clientCfg)
+	if err != nil {
+		conn.Close()
+		c.bastion.Close()
+		return nil, errors.Wrapf(err, "error connecting to %s", host)
+	}
+	c.client = ssh.NewClient(clientConn, chans, reqs)
+
+	return c, c.forwardAgent()
+}
+
+// Run runs the command on the server, writing its output to stdout and
+// stderr. Returns the command exit status.
+func (c *Client) Run(command string, stdout, stderr io.Writer) (int, error) {
+	session, err := c.newSession()
+	if err != nil {
+		return -1, err
+	}
+	defer session.Close()
+
+	session.Stdout = stdout
+	session.Stderr = stderr
+
+	err = session.Run(command)
+	if exitErr, ok := err.(*ssh.ExitError); ok {
+		return exitErr.ExitStatus(), nil
+	}
+	if err != nil {
+		return -1, errors.Wrap(err, "error running command")
+	}
+	return 0, nil
+}
+
+// Close closes the connections to the server and the bastion host.
+func (c *Client) Close() error {
+	err := c.client.Close()
+	if c.bastion != nil {
+		c.bastion.Close()
+	}
+	return err
+}
+
+// newSession opens a new session, requesting agent forwarding if enabled.
+func (c *Client) newSession() (*ssh.Session, error) {
+	session, err := c.client.NewSession()
+	if err != nil {
+		return nil, errors.Wrap(err, "error opening session")
+	}
+
+	if c.cfg.ForwardAgent && c.agent != nil {
+		if err = agent.RequestAgentForwarding(session); err != nil {
+			session.Close()
+			return nil, errors.Wrap(err, "error requesting agent forwarding")
+		}
+	}
+	return session, nil
+}
+
+// forwardAgent forwards the agent requests from the server to the local ssh
+// agent if agent forwarding is enabled.
+func (c *Client) forwardAgent() error {
+	if !c.cfg.ForwardAgent {
+		return nil
+	}
+	if c.agent == nil {
+		return errors.New("agent forwarding requested but SSH_AUTH_SOCK is not set")
+	}
+	return errors.Wrap(agent.ForwardToAgent(c.client, c.agent), "error forwarding agent")
+}
+
+// clientConfig creates the ssh client configuration for the address. The
+// host key algorithms of the keys known for the address are preferred, so
+// the key recorded by OpenSSH is verified instead of another one the host
+// has.
+func (c *Client) clientConfig(addr string) (*ssh.ClientConfig, error) {
+	signers, err := c.signers()
+	if err != nil {
+		return nil, err
+	}
+
+	auth := []ssh.AuthMethod{}
+	if c.agent != nil {
+		auth = append(auth, ssh.PublicKeysCallback(c.agent.Signers))
+	}
+	if len(signers) > 0 {
+		auth = append(auth, ssh.PublicKeys(signers...))
+	}
+	if len(auth) == 0 {
+		return nil, errors.New("no ssh keys found, start ssh agent or pass an identity file")
+	}
+
+	return &ssh.ClientConfig{
+		User:              c.cfg.User,
+		Auth:              auth,
+		HostKeyCallback:   knownHostsCallback(c.cfg.KnownHostsFile),
+		HostKeyAlgorithms: knownHostKeyAlgorithms(c.cfg.KnownHostsFile, addr),
+		Timeout:           c.cfg.Timeout,
+	}, nil
+}
+
+// signers loads the identity file, or the default identity files if none is
+// configured. Passphrase protected default keys are skipped, they can be
+// used through the ssh agent.
+func (c *Client) signers() ([]ssh.Signer, error) {
+	if c.cfg.IdentityFile != "" {
+		signer, err := loadSigner(c.cfg.IdentityFile)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error loading identity file %s", c.cfg.IdentityFile)
+		}
+		return []ssh.Signer{signer}, nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, nil
+	}
+
+	signers := []ssh.Signer{}
+	for _, file := range defaultIdentityFiles {
+		if signer, err := loadSigner(filepath.Join(home, file)); err == nil {
+			signers = append(signers, signer)
+		}
+	}
+	return signers, nil
+}
+
+// loadSigner loads a private key file.
+func loadSigner(file string) (ssh.Signer, error) {
+	key, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return ssh.ParsePrivateKey(key)
+}
+
+// withPort adds the default ssh port to the host if it has none.
+func withPort(host string) string {
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+	return net.JoinHostPort(strings.Trim(host, "[]"), defaultPort)
+}
+
+// warnf prints a warning message to stderr.
+func warnf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+}
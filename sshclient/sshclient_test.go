@@ -0,0 +1,355 @@
+package sshclient
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// testServer is an in-process ssh server.
+type testServer struct {
+	addr     string
+	hostKeys []ssh.Signer
+	listener net.Listener
+}
+
+// newTestServer starts an ssh server with the host keys, accepting the user
+// key and passing the channels to the handler.
+func newTestServer(t *testing.T, userKey ssh.PublicKey, hostKeys []ssh.Signer, handle func(ssh.NewChannel)) *testServer {
+	t.Helper()
+
+	cfg := &ssh.ServerConfig{
+		PublicKeyCallback: func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if !bytes.Equal(key.Marshal(), userKey.Marshal()) {
+				return nil, fmt.Errorf("unknown public key")
+			}
+			return nil, nil
+		},
+	}
+	for _, key := range hostKeys {
+		cfg.AddHostKey(key)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_, chans, reqs, err := ssh.NewServerConn(conn, cfg)
+				if err != nil {
+					conn.Close()
+					return
+				}
+				go ssh.DiscardRequests(reqs)
+				for ch := range chans {
+					go handle(ch)
+				}
+			}()
+		}
+	}()
+
+	return &testServer{addr: listener.Addr().String(), hostKeys: hostKeys, listener: listener}
+}
+
+// Close stops the server.
+func (s *testServer) Close() {
+	s.listener.Close()
+}
+
+// handleJump forwards the direct-tcpip channels, as a bastion host does.
+func handleJump(newCh ssh.NewChannel) {
+	if newCh.ChannelType() != "direct-tcpip" {
+		newCh.Reject(ssh.UnknownChannelType, "unsupported channel type")
+		return
+	}
+
+	var target struct {
+		Host     string
+		Port     uint32
+		OrigHost string
+		OrigPort uint32
+	}
+	if err := ssh.Unmarshal(newCh.ExtraData(), &target); err != nil {
+		newCh.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+
+	conn, err := net.Dial("tcp", net.JoinHostPort(target.Host, fmt.Sprint(target.Port)))
+	if err != nil {
+		newCh.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+
+	ch, reqs, err := newCh.Accept()
+	if err != nil {
+		conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+
+	go func() {
+		io.Copy(conn, ch)
+		conn.Close()
+	}()
+	io.Copy(ch, conn)
+	ch.Close()
+}
+
+// handleExec runs `exit <status>` commands, printing the command and exiting
+// with the status.
+func handleExec(newCh ssh.NewChannel) {
+	if newCh.ChannelType() != "session" {
+		newCh.Reject(ssh.UnknownChannelType, "unsupported channel type")
+		return
+	}
+
+	ch, reqs, err := newCh.Accept()
+	if err != nil {
+		return
+	}
+	defer ch.Close()
+
+	for req := range reqs {
+		if req.Type != "exec" {
+			req.Reply(false, nil)
+			continue
+		}
+
+		var exec struct{ Command string }
+		if err := ssh.Unmarshal(req.Payload, &exec); err != nil {
+			req.Reply(false, nil)
+			continue
+		}
+		req.Reply(true, nil)
+
+		var status uint32
+		fmt.Sscanf(exec.Command, "exit %d", &status)
+		fmt.Fprintf(ch, "ran: %s\n", exec.Command)
+		ch.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{status}))
+		return
+	}
+}
+
+// newECDSASigner generates an ECDSA key.
+func newECDSASigner(t *testing.T) (*ecdsa.PrivateKey, ssh.Signer) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, signer
+}
+
+// newED25519Signer generates an ED25519 key.
+func newED25519Signer(t *testing.T) ssh.Signer {
+	t.Helper()
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+// testEnv stores the user key and the known hosts file of a test.
+type testEnv struct {
+	cfg     Config
+	userKey ssh.PublicKey
+}
+
+// newTestEnv writes a user identity file to a temporary directory and
+// returns the client config using it, with the known hosts file in the same
+// directory.
+func newTestEnv(t *testing.T) (*testEnv, func()) {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "fst-sshclient")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, signer := newECDSASigner(t)
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	identityFile := filepath.Join(dir, "id_ecdsa")
+	if err = ioutil.WriteFile(identityFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	sock := os.Getenv("SSH_AUTH_SOCK")
+	os.Unsetenv("SSH_AUTH_SOCK")
+
+	env := &testEnv{
+		cfg: Config{
+			User:           "test",
+			IdentityFile:   identityFile,
+			KnownHostsFile: filepath.Join(dir, "known_hosts"),
+			Timeout:        5 * time.Second,
+		},
+		userKey: signer.PublicKey(),
+	}
+	return env, func() {
+		os.Setenv("SSH_AUTH_SOCK", sock)
+		os.RemoveAll(dir)
+	}
+}
+
+// addKnownHost writes the key of the server address to the known hosts
+// file.
+func (e *testEnv) addKnownHost(t *testing.T, addr string, key ssh.PublicKey) {
+	t.Helper()
+
+	f, err := os.OpenFile(e.cfg.KnownHostsFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if _, err = fmt.Fprintln(f, knownhosts.Line([]string{knownhosts.Normalize(addr)}, key)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDialThroughBastion(t *testing.T) {
+	env, cleanup := newTestEnv(t)
+	defer cleanup()
+
+	target := newTestServer(t, env.userKey, []ssh.Signer{newED25519Signer(t)}, handleExec)
+	defer target.Close()
+	bastion := newTestServer(t, env.userKey, []ssh.Signer{newED25519Signer(t)}, handleJump)
+	defer bastion.Close()
+
+	tests := []struct {
+		command    string
+		wantStatus int
+	}{
+		{command: "exit 0", wantStatus: 0},
+		{command: "exit 3", wantStatus: 3},
+		{command: "exit 255", wantStatus: 255},
+	}
+
+	for _, tt := range tests {
+		client, err := Dial(env.cfg, bastion.addr, target.addr)
+		if err != nil {
+			t.Fatalf("Dial error: %v", err)
+		}
+
+		stdout := &bytes.Buffer{}
+		status, err := client.Run(tt.command, stdout, ioutil.Discard)
+		client.Close()
+		if err != nil {
+			t.Errorf("Run(%q) error: %v", tt.command, err)
+			continue
+		}
+		if status != tt.wantStatus {
+			t.Errorf("Run(%q) status = %d, want %d", tt.command, status, tt.wantStatus)
+		}
+		if want := "ran: " + tt.command + "\n"; stdout.String() != want {
+			t.Errorf("Run(%q) output = %q, want %q", tt.command, stdout.String(), want)
+		}
+	}
+
+	data, err := ioutil.ReadFile(env.cfg.KnownHostsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, server := range []*testServer{bastion, target} {
+		want := knownhosts.Line([]string{knownhosts.Normalize(server.addr)}, server.hostKeys[0].PublicKey())
+		if strings.Count(string(data), want) != 1 {
+			t.Errorf("known hosts file missing %s once:\n%s", want, data)
+		}
+	}
+}
+
+func TestKnownHosts(t *testing.T) {
+	env, cleanup := newTestEnv(t)
+	defer cleanup()
+
+	_, ecdsaKey := newECDSASigner(t)
+	ed25519Key := newED25519Signer(t)
+	server := newTestServer(t, env.userKey, []ssh.Signer{ecdsaKey, ed25519Key}, handleExec)
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		known   ssh.PublicKey
+		wantErr string
+	}{
+		{name: "unknown host is added"},
+		{name: "known key", known: ecdsaKey.PublicKey()},
+		{name: "known key of a less preferred algorithm", known: ed25519Key.PublicKey()},
+		{name: "changed key", known: newED25519Signer(t).PublicKey(), wantErr: "remote host identification has changed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Remove(env.cfg.KnownHostsFile)
+			if tt.known != nil {
+				env.addKnownHost(t, server.addr, tt.known)
+			}
+
+			client, err := Dial(env.cfg, "", server.addr)
+			if tt.wantErr != "" {
+				if err == nil {
+					client.Close()
+				}
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Dial error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Dial error: %v", err)
+			}
+			client.Close()
+
+			data, err := ioutil.ReadFile(env.cfg.KnownHostsFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if lines := strings.Count(string(data), "\n"); lines != 1 {
+				t.Errorf("known hosts file has %d lines, want 1:\n%s", lines, data)
+			}
+
+			// The key added on the first connection is accepted afterwards.
+			if client, err = Dial(env.cfg, "", server.addr); err != nil {
+				t.Fatalf("second Dial error: %v", err)
+			}
+			client.Close()
+		})
+	}
+}
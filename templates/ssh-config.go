@@ -1,12 +1,119 @@
 package templates
 
+import (
+	"strings"
+
+	"github.com/alecthomas/template"
+)
+
 // SSHConfig stores the ssh config template.
-var SSHConfig = `{{range .BastionHosts}}# Bastion - {{.Region}} #{{.ID}}
+var SSHConfig = `{{range .BastionHosts}}# Bastion - {{.Region}} #{{.ID}}{{if .VPCID}} ({{.VPCID}}){{end}}
 Host {{.Region}}-0{{.ID}}
 HostName {{.IP}}
 StrictHostKeyChecking no
 
+{{end}}{{range .Servers}}# {{.Region}}{{if .Env}} - {{.Env}}{{end}}
+Host {{.Host}}
+HostName {{.IP}}
+{{if .JumpHost}}ProxyJump {{.JumpHost}}
+{{end}}{{if .User}}User {{.User}}
+{{end}}{{if .IdentityFile}}IdentityFile {{.IdentityFile}}
+{{end}}StrictHostKeyChecking no
+
+{{end}}{{range .ProxyJumps}}# ProxyJump configuration - {{.Region}} {{.VPCID}} {{.CIDR}}
+Host {{.Hosts}}
+ProxyJump {{.JumpHost}}
+StrictHostKeyChecking no
+
 {{end}}# ProxyJump configuration
-Host 172.*
+Host {{.PrivateHosts}}
 ProxyJump {{.JumpHost}}
 StrictHostKeyChecking no`
+
+// SSHConfigData stores the data the ssh config templates are executed with.
+type SSHConfigData struct {
+	// JumpHost is the ssh config name of the bastion host used in the
+	// ProxyJump configuration of the private networks.
+	JumpHost string
+	// PrivateHosts stores the host patterns of the RFC 1918 and configured
+	// private networks, space separated.
+	PrivateHosts string
+	// ProxyJumps stores the ProxyJump configuration of every VPC CIDR block,
+	// it's empty if the VPCs can't be discovered.
+	ProxyJumps []ProxyJump
+	// BastionHosts stores all the configured bastion hosts.
+	BastionHosts []BastionHost
+	// Servers stores the servers to add Host entries for, it's empty unless
+	// the servers are requested.
+	Servers []ServerHost
+	// Regions stores the configured regions.
+	Regions []string
+	// User and IdentityFile store the ssh settings from the config file.
+	User         string
+	IdentityFile string
+}
+
+// BastionHost stores a single bastion host data.
+type BastionHost struct {
+	Region     string
+	Name       string
+	InstanceID string
+	IP         string
+	VPCID      string
+	// ID is the position of the bastion host in the region, starting at 1.
+	ID int
+	// Alias is the ssh config name of the bastion host: <region>-0<id>.
+	Alias string
+}
+
+// ProxyJump stores the ProxyJump configuration of a single VPC CIDR block.
+type ProxyJump struct {
+	Region string
+	VPCID  string
+	CIDR   string
+	// Hosts stores the host patterns matching the CIDR block, space
+	// separated, as ssh doesn't support the CIDR notation.
+	Hosts string
+	// JumpHost is the ssh config name of the bastion host routing to the VPC.
+	JumpHost string
+}
+
+// ServerHost stores a single server data.
+type ServerHost struct {
+	// Host is the ssh config name of the server, the server name if it's
+	// unique, otherwise with the instance id appended.
+	Host       string
+	Name       string
+	InstanceID string
+	Region     string
+	Env        string
+	Type       string
+	VPCID      string
+	IP         string
+	PublicIP   string
+	Tags       map[string]string
+	// JumpHost is the ssh config name of the bastion host to reach the
+	// server through, it's empty if the server doesn't need one.
+	JumpHost     string
+	User         string
+	IdentityFile string
+}
+
+// Funcs stores the helper functions available in the ssh config templates.
+var Funcs = template.FuncMap{
+	// lower returns the value with all letters lower case.
+	"lower": strings.ToLower,
+	// replace returns the value with all old substrings replaced by new, e.g.
+	// {{.Name | replace " " "-"}}.
+	"replace": func(old, new, value string) string {
+		return strings.Replace(value, old, new, -1)
+	},
+	// default returns the value, or def if the value is empty, e.g.
+	// {{.User | default "ec2-user"}}.
+	"default": func(def, value string) string {
+		if value == "" {
+			return def
+		}
+		return value
+	},
+}
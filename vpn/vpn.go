@@ -16,6 +16,7 @@ import (
 	"path/filepath"
 	"runtime"
 	"strings"
+	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/pkg/errors"
@@ -295,6 +296,22 @@ func (p *Pritunl) setAuthHeaders(headers http.Header) {
 	headers.Set("User-Agent", "pritunl")
 }
 
+// CheckSocket checks that the Pritunl client service accepts connections on
+// its unix socket.
+func CheckSocket() error {
+	conn, err := net.DialTimeout("unix", unixSocketPath, 2*time.Second)
+	if err != nil {
+		return errors.Wrap(err, "error connecting to pritunl service")
+	}
+	return conn.Close()
+}
+
+// CheckAuthKey checks that the Pritunl auth key file is readable.
+func CheckAuthKey() error {
+	_, err := getAuthKey()
+	return errors.Wrap(err, "error getting auth key")
+}
+
 // getAuthKey reads the auth key file and returns its contents.
 func getAuthKey() (string, error) {
 	if _, err := os.Stat(authKeyPath); !os.IsNotExist(err) {